@@ -24,11 +24,13 @@ SOFTWARE.
 package articlewrap
 
 import "github.com/vmihailenco/msgpack"
+import "io"
 import "github.com/byte-mug/fastnntp/posting"
 import "github.com/maxymania/fastnntp-polyglot"
 import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore"
 import "github.com/maxymania/fastnntp-polyglot-labs/bufferex"
 import "github.com/maxymania/fastnntp-polyglot/policies"
+import "github.com/maxymania/fastnntp-polyglot-labs/policies_ex"
 //import "github.com/maxymania/fastnntp-polyglot/buffer"
 
 func repool(bak, work *[]byte) {
@@ -79,6 +81,54 @@ func (adb *ArticleDirectBackend) ArticleDirectGet(id []byte, head, body bool) *n
 	}
 	return obj
 }
+/*
+Writes the (decompressed) body of an article to w. Unlike ArticleDirectGet, the body is
+streamed from the store and decompressed incrementally, so large bodies don't need to fit
+into a single buffer.
+*/
+func (adb *ArticleDirectBackend) ArticleDirectWriteBody(id []byte, w io.Writer) (ok bool,err error) {
+	bin,_ := adb.Bdb.QueryIDMapping(id)
+	defer bin.Free()
+	if len(bin.Bytes())==0 { return } // Not found
+	
+	body,_,ok,err := bucketstore.OverGetReader(adb.Store,bin.Bytes(),id,nil,nil)
+	if err!=nil || !ok { return false,err }
+	defer body.Close()
+	_,err = zdecodeTo(w,body)
+	return
+}
+/*
+Writes length bytes (or the rest, if length<0) of the (decompressed) body of an article to w, starting at
+offset off. If the body has been stored uncompressed (see policies_ex.RawDeflate), only the requested
+range is transferred from the store, otherwise the body is decompressed up to the end of the range.
+*/
+func (adb *ArticleDirectBackend) ArticleDirectWriteBodyRange(id []byte, off, length int64, w io.Writer) (ok bool,err error) {
+	var mark [1]byte
+	bin,_ := adb.Bdb.QueryIDMapping(id)
+	defer bin.Free()
+	if len(bin.Bytes())==0 { return } // Not found
+	
+	body,_,ok,err := bucketstore.OverGetRange(adb.Store,bin.Bytes(),id,0,1)
+	if err!=nil || !ok { return false,err }
+	_,err = io.ReadFull(body,mark[:])
+	body.Close()
+	if err!=nil { return false,err }
+	
+	if mark[0]!=policies_ex.RawMarker {
+		body,_,ok,err = bucketstore.OverGetReader(adb.Store,bin.Bytes(),id,nil,nil)
+		if err!=nil || !ok { return false,err }
+		defer body.Close()
+		err = zdecodeRangeTo(w,body,off,length)
+		return
+	}
+	if length==0 { return }
+	
+	body,_,ok,err = bucketstore.OverGetRange(adb.Store,bin.Bytes(),id,off+1,length)
+	if err!=nil || !ok { return false,err }
+	defer body.Close()
+	_,err = io.Copy(w,body)
+	return
+}
 func (adb *ArticleDirectBackend) ArticleDirectOverview(id []byte) *newspolyglot.ArticleOverview {
 	bin,_ := adb.Bdb.QueryIDMapping(id)
 	defer bin.Free()
@@ -201,23 +251,29 @@ func (adb *ArticleDirectBackend) ArticlePostingPost(headp *posting.HeadInfo, bod
 	
 	overv,_ := msgpack.Marshal(ao.Subject,ao.From,ao.Date,ao.MsgId,ao.Refs,ao.Bytes,ao.Lines)
 	
-	decision := policies.Def(adb.Policy).Decide(ngs,ao.Lines,ao.Bytes)
+	var decision policies.PostingDecision
+	var class string
+	if cp,ok := adb.Policy.(policies_ex.ClassPolicy) ; ok {
+		decision,class = cp.DecideClass(ngs,ao.Lines,ao.Bytes)
+	} else {
+		decision = policies.Def(adb.Policy).Decide(ngs,ao.Lines,ao.Bytes)
+	}
 	
 	overv = decision.CompressXover.Def()(policies.DEFLATE{},overv)
 	head := decision.CompressHeader.Def()(policies.DEFLATE{},headp.RAW)
 	body  = decision.CompressBody.Def()(policies.DEFLATE{},body)
 	
 	var bucket bufferex.Binary
-	bucket,err = adb.Store.Submit(headp.MessageId, overv, head, body, decision.ExpireAt)
+	if cs,ok := adb.Store.(bucketstore.ClassSubmitter) ; ok && class!="" {
+		bucket,err = cs.SubmitClass(class, headp.MessageId, overv, head, body, decision.ExpireAt)
+	} else {
+		bucket,err = adb.Store.Submit(headp.MessageId, overv, head, body, decision.ExpireAt)
+	}
+	defer bucket.Free()
 	if err!=nil || len(bucket.Bytes())==0 { failed = true ; err = nil ; return } // Storage-Failure = failure
 	
-	defer bucket.Free()
-	err = adb.Bdb.InsertIDMapping(headp.MessageId,bucket.Bytes(),decision.ExpireAt)
+	err = adb.insertMappings(headp.MessageId,bucket.Bytes(),ngs,numbs,decision.ExpireAt)
 	if err!=nil { failed = true ; err = nil ; return } // ...Ditto
-	for i,group := range ngs {
-		err = adb.Bdb.InsertGoupMapping(group,numbs[i],headp.MessageId, decision.ExpireAt)
-		if err!=nil { failed = true ; err = nil ; return } // ...Ditto
-	}
 	return
 }
 func (adb *ArticleDirectBackend) ArticlePostingCheckPost() (possible bool) {
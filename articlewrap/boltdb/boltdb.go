@@ -0,0 +1,341 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+/*
+An embedded implementation of articlewrap.BucketDatabase on top of BoltDB.
+
+Key layout:
+	groups: group + 0x00 + num (8 byte, big endian)        -> groupEntry (msgid, expire)
+	msgids: msgid                                          -> idEntry (bucket, expire)
+	expiry: expire (8 byte, big endian) + kind + group/msgid key -> (empty)
+
+The kind is 'g' for keys of "groups" and 'i' for keys of "msgids". Within a group, the
+entries are sorted by number, so QueryGroupShift and QueryGroupList are cursor operations.
+Expire walks the expiry index up to the given time.
+*/
+package boltdb
+
+import "bytes"
+import "encoding/binary"
+import "errors"
+import "time"
+import "github.com/boltdb/bolt"
+import "github.com/vmihailenco/msgpack"
+import "github.com/maxymania/fastnntp-polyglot-labs/bufferex"
+
+var EDuplicate = errors.New("Duplicate mapping")
+
+var bE = binary.BigEndian
+
+var bktGroups = []byte("groups")
+var bktMsgids = []byte("msgids")
+var bktExpiry = []byte("expiry")
+
+const (
+	kindGroup = 'g'
+	kindMsgid = 'i'
+)
+
+const pageSize = 256
+
+type groupEntry struct{
+	_msgpack struct{} `msgpack:",asArray"`
+	Msgid  []byte
+	Expire int64
+}
+type idEntry struct{
+	_msgpack struct{} `msgpack:",asArray"`
+	Bucket []byte
+	Expire int64
+}
+
+func groupPrefix(group []byte) []byte {
+	return append(append(make([]byte,0,len(group)+9),group...),0)
+}
+func groupKey(group []byte, num int64) []byte {
+	k := groupPrefix(group)
+	k = k[:len(k)+8]
+	bE.PutUint64(k[len(k)-8:],uint64(num))
+	return k
+}
+func expiryKey(expire int64, kind byte, key []byte) []byte {
+	k := make([]byte,9,9+len(key))
+	bE.PutUint64(k,uint64(expire))
+	k[8] = kind
+	return append(k,key...)
+}
+
+// Use New or Open to create it, the buckets must exist.
+type Base struct{
+	DB *bolt.DB
+}
+
+// Creates the buckets, if missing.
+func New(db *bolt.DB) (*Base,error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		for _,n := range [][]byte{bktGroups,bktMsgids,bktExpiry} {
+			if _,err := tx.CreateBucketIfNotExists(n) ; err!=nil { return err }
+		}
+		return nil
+	})
+	if err!=nil { return nil,err }
+	return &Base{db},nil
+}
+
+// Opens (or creates) the database file at path.
+func Open(path string) (*Base,error) {
+	db,err := bolt.Open(path,0600,nil)
+	if err!=nil { return nil,err }
+	b,err := New(db)
+	if err!=nil { db.Close() }
+	return b,err
+}
+
+func putGroup(tx *bolt.Tx, group []byte, num int64, msgid []byte, expire time.Time) error {
+	gk := groupKey(group,num)
+	grp := tx.Bucket(bktGroups)
+	if len(grp.Get(gk))!=0 { return EDuplicate }
+	v,err := msgpack.Marshal(&groupEntry{Msgid:msgid,Expire:expire.Unix()})
+	if err!=nil { return err }
+	if err = grp.Put(gk,v) ; err!=nil { return err }
+	return tx.Bucket(bktExpiry).Put(expiryKey(expire.Unix(),kindGroup,gk),nil)
+}
+func putMsgid(tx *bolt.Tx, msgid, bucket []byte, expire time.Time) error {
+	ids := tx.Bucket(bktMsgids)
+	if len(ids.Get(msgid))!=0 { return EDuplicate }
+	v,err := msgpack.Marshal(&idEntry{Bucket:bucket,Expire:expire.Unix()})
+	if err!=nil { return err }
+	if err = ids.Put(msgid,v) ; err!=nil { return err }
+	return tx.Bucket(bktExpiry).Put(expiryKey(expire.Unix(),kindMsgid,msgid),nil)
+}
+
+func (b *Base) InsertGoupMapping(group []byte, num int64, msgid []byte, expire time.Time) error {
+	return b.DB.Batch(func(tx *bolt.Tx) error { return putGroup(tx,group,num,msgid,expire) })
+}
+func (b *Base) InsertIDMapping(msgid, bucket []byte, expire time.Time) error {
+	return b.DB.Batch(func(tx *bolt.Tx) error { return putMsgid(tx,msgid,bucket,expire) })
+}
+
+// Implements articlewrap.MappingInserter.
+func (b *Base) InsertMappings(msgid, bucket []byte, groups [][]byte, nums []int64, expire time.Time) error {
+	return b.DB.Batch(func(tx *bolt.Tx) error {
+		if err := putMsgid(tx,msgid,bucket,expire) ; err!=nil { return err }
+		for i,group := range groups {
+			if err := putGroup(tx,group,nums[i],msgid,expire) ; err!=nil { return err }
+		}
+		return nil
+	})
+}
+
+// Implements articlewrap.IDMappingUpdater.
+func (b *Base) UpdateIDMapping(msgid, bucket []byte) error {
+	return b.DB.Batch(func(tx *bolt.Tx) error {
+		ids := tx.Bucket(bktMsgids)
+		var ent idEntry
+		if msgpack.Unmarshal(ids.Get(msgid),&ent)!=nil { return nil }
+		ent.Bucket = bucket
+		v,err := msgpack.Marshal(&ent)
+		if err!=nil { return err }
+		return ids.Put(msgid,v)
+	})
+}
+
+// Implements articlewrap.IDMappingDeleter.
+func (b *Base) DeleteIDMapping(msgid []byte) error {
+	return b.DB.Batch(func(tx *bolt.Tx) error {
+		ids := tx.Bucket(bktMsgids)
+		var ent idEntry
+		if msgpack.Unmarshal(ids.Get(msgid),&ent)!=nil { return nil }
+		if err := tx.Bucket(bktExpiry).Delete(expiryKey(ent.Expire,kindMsgid,msgid)) ; err!=nil { return err }
+		return ids.Delete(msgid)
+	})
+}
+
+// Implements articlewrap.GroupMappingDeleter.
+func (b *Base) DeleteGroupMapping(group []byte, num int64, msgid []byte) error {
+	gk := groupKey(group,num)
+	return b.DB.Batch(func(tx *bolt.Tx) error {
+		grp := tx.Bucket(bktGroups)
+		var ent groupEntry
+		if msgpack.Unmarshal(grp.Get(gk),&ent)!=nil { return nil }
+		if !bytes.Equal(ent.Msgid,msgid) { return nil }
+		if err := tx.Bucket(bktExpiry).Delete(expiryKey(ent.Expire,kindGroup,gk)) ; err!=nil { return err }
+		return grp.Delete(gk)
+	})
+}
+
+/*
+Removes all mappings expiring at or before expire. The expiry index is processed page by page,
+so that no single transaction grows too large.
+*/
+func (b *Base) Expire(expire time.Time) error {
+	var limit [8]byte
+	bE.PutUint64(limit[:],uint64(expire.Unix()))
+	for {
+		done := true
+		err := b.DB.Update(func(tx *bolt.Tx) error {
+			exp := tx.Bucket(bktExpiry)
+			grp := tx.Bucket(bktGroups)
+			ids := tx.Bucket(bktMsgids)
+			var keys [][]byte
+			cur := exp.Cursor()
+			for key,_ := cur.First() ; len(key)>9 && bytes.Compare(key[:8],limit[:])<=0 ; key,_ = cur.Next() {
+				if len(keys)==pageSize { done = false ; break }
+				keys = append(keys,append([]byte(nil),key...))
+			}
+			for _,key := range keys {
+				var err error
+				switch key[8] {
+				case kindGroup: err = grp.Delete(key[9:])
+				case kindMsgid: err = ids.Delete(key[9:])
+				}
+				if err==nil { err = exp.Delete(key) }
+				if err!=nil { return err }
+			}
+			return nil
+		})
+		if err!=nil || done { return err }
+	}
+}
+
+func (b *Base) QueryGroupMapping(group []byte, num int64) (msgid, bucket bufferex.Binary,err error) {
+	gk := groupKey(group,num)
+	err = b.DB.View(func(tx *bolt.Tx) error {
+		var gent groupEntry
+		var ient idEntry
+		if msgpack.Unmarshal(tx.Bucket(bktGroups).Get(gk),&gent)!=nil { return nil }
+		if msgpack.Unmarshal(tx.Bucket(bktMsgids).Get(gent.Msgid),&ient)!=nil { return nil }
+		msgid = bufferex.NewBinary(gent.Msgid)
+		bucket = bufferex.NewBinary(ient.Bucket)
+		return nil
+	})
+	return
+}
+func (b *Base) QueryIDMapping(msgid []byte) (bucket bufferex.Binary,err error) {
+	err = b.DB.View(func(tx *bolt.Tx) error {
+		var ent idEntry
+		if msgpack.Unmarshal(tx.Bucket(bktMsgids).Get(msgid),&ent)!=nil { return nil }
+		bucket = bufferex.NewBinary(ent.Bucket)
+		return nil
+	})
+	return
+}
+
+func (b *Base) QueryGroupShift(group []byte, num int64, backward bool) (nxt int64,msgid bufferex.Binary,err error) {
+	prefix := groupPrefix(group)
+	gk := groupKey(group,num)
+	err = b.DB.View(func(tx *bolt.Tx) error {
+		cur := tx.Bucket(bktGroups).Cursor()
+		key,val := cur.Seek(gk)
+		if backward {
+			if len(key)==0 { key,val = cur.Last() } else { key,val = cur.Prev() }
+		} else if bytes.Equal(key,gk) {
+			key,val = cur.Next()
+		}
+		if len(key)!=len(prefix)+8 || !bytes.HasPrefix(key,prefix) { return nil }
+		var ent groupEntry
+		if err := msgpack.Unmarshal(val,&ent) ; err!=nil { return err }
+		nxt = int64(bE.Uint64(key[len(prefix):]))
+		msgid = bufferex.NewBinary(ent.Msgid)
+		return nil
+	})
+	return
+}
+
+type listEntry struct{
+	num           int64
+	bucket, msgid []byte
+}
+
+/*
+The group is read page by page, so that no transaction is held open while targ runs.
+Like the LEFT OUTER JOIN of the SQL implementation, the bucket is empty, if the ID mapping is missing.
+*/
+func (b *Base) QueryGroupList(group []byte, first, last int64, targ func(num int64, bucket, msgid bufferex.Binary)) error {
+	prefix := groupPrefix(group)
+	page := make([]listEntry,0,pageSize)
+	for first<=last {
+		page = page[:0]
+		err := b.DB.View(func(tx *bolt.Tx) error {
+			cur := tx.Bucket(bktGroups).Cursor()
+			ids := tx.Bucket(bktMsgids)
+			var gent groupEntry
+			var ient idEntry
+			for key,val := cur.Seek(groupKey(group,first)) ; len(page)<pageSize && len(key)==len(prefix)+8 && bytes.HasPrefix(key,prefix) ; key,val = cur.Next() {
+				num := int64(bE.Uint64(key[len(prefix):]))
+				if num>last { break }
+				if msgpack.Unmarshal(val,&gent)!=nil { continue }
+				ient.Bucket = nil
+				msgpack.Unmarshal(ids.Get(gent.Msgid),&ient)
+				page = append(page,listEntry{num,append([]byte(nil),ient.Bucket...),append([]byte(nil),gent.Msgid...)})
+			}
+			return nil
+		})
+		if err!=nil { return err }
+		for _,ent := range page {
+			targ(ent.num,bufferex.NewBinary(ent.bucket),bufferex.NewBinary(ent.msgid))
+		}
+		if len(page)<pageSize { return nil }
+		first = page[len(page)-1].num+1
+	}
+	return nil
+}
+
+/*
+Implements articlewrap.IDMappingLister. The mappings are read page by page, so that no
+transaction is held open while targ runs.
+*/
+func (b *Base) ListIDMappings(after []byte, targ func(msgid, bucket []byte, expire time.Time) bool) error {
+	type mapping struct{
+		msgid, bucket []byte
+		expire time.Time
+	}
+	page := make([]mapping,0,pageSize)
+	last := append([]byte(nil),after...)
+	for {
+		page = page[:0]
+		err := b.DB.View(func(tx *bolt.Tx) error {
+			cur := tx.Bucket(bktMsgids).Cursor()
+			var key,val []byte
+			if len(last)==0 {
+				key,val = cur.First()
+			} else {
+				key,val = cur.Seek(last)
+				if bytes.Equal(key,last) { key,val = cur.Next() }
+			}
+			var ent idEntry
+			for ; len(key)>0 && len(page)<pageSize ; key,val = cur.Next() {
+				if msgpack.Unmarshal(val,&ent)!=nil { continue }
+				page = append(page,mapping{append([]byte(nil),key...),append([]byte(nil),ent.Bucket...),time.Unix(ent.Expire,0).UTC()})
+			}
+			return nil
+		})
+		if err!=nil { return err }
+		if len(page)==0 { return nil }
+		for _,m := range page {
+			if !targ(m.msgid,m.bucket,m.expire) { return nil }
+		}
+		last = page[len(page)-1].msgid
+	}
+}
@@ -0,0 +1,102 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package boltdb
+
+import "bytes"
+import "time"
+import "github.com/boltdb/bolt"
+import "github.com/vmihailenco/msgpack"
+import "github.com/maxymania/fastnntp-polyglot-labs/articlewrap"
+
+/*
+Implements articlewrap.GroupMappingLister. The mappings are read page by page, so that no
+transaction is held open while targ runs.
+*/
+func (b *Base) ListGroupMappings(group []byte, num int64, targ func(group []byte, num int64, msgid []byte, expire time.Time) bool) error {
+	type mapping struct{
+		key, msgid []byte
+		expire time.Time
+	}
+	page := make([]mapping,0,pageSize)
+	var last []byte
+	if len(group)!=0 { last = groupKey(group,num) }
+	for {
+		page = page[:0]
+		err := b.DB.View(func(tx *bolt.Tx) error {
+			cur := tx.Bucket(bktGroups).Cursor()
+			var key,val []byte
+			if len(last)==0 {
+				key,val = cur.First()
+			} else {
+				key,val = cur.Seek(last)
+				if bytes.Equal(key,last) { key,val = cur.Next() }
+			}
+			var ent groupEntry
+			for ; len(key)>9 && len(page)<pageSize ; key,val = cur.Next() {
+				if msgpack.Unmarshal(val,&ent)!=nil { continue }
+				page = append(page,mapping{append([]byte(nil),key...),append([]byte(nil),ent.Msgid...),time.Unix(ent.Expire,0).UTC()})
+			}
+			return nil
+		})
+		if err!=nil { return err }
+		if len(page)==0 { return nil }
+		for _,m := range page {
+			n := len(m.key)-9
+			if !targ(m.key[:n],int64(bE.Uint64(m.key[n+1:])),m.msgid,m.expire) { return nil }
+		}
+		last = page[len(page)-1].key
+	}
+}
+
+// Removes the entry and its expiry index entry, if it exists.
+func unput(tx *bolt.Tx, bkt []byte, kind byte, key []byte) error {
+	var ent groupEntry // Expire is the last field of both, groupEntry and idEntry.
+	b := tx.Bucket(bkt)
+	if msgpack.Unmarshal(b.Get(key),&ent)!=nil { return nil }
+	if err := tx.Bucket(bktExpiry).Delete(expiryKey(ent.Expire,kind,key)) ; err!=nil { return err }
+	return b.Delete(key)
+}
+
+// Implements articlewrap.MappingImporter.
+func (b *Base) ImportIDMappings(m []articlewrap.IDMapping) error {
+	return b.DB.Update(func(tx *bolt.Tx) error {
+		for _,a := range m {
+			if err := unput(tx,bktMsgids,kindMsgid,a.Msgid) ; err!=nil { return err }
+			if err := putMsgid(tx,a.Msgid,a.Bucket,a.Expire) ; err!=nil { return err }
+		}
+		return nil
+	})
+}
+
+// Implements articlewrap.MappingImporter.
+func (b *Base) ImportGroupMappings(m []articlewrap.GroupMapping) error {
+	return b.DB.Update(func(tx *bolt.Tx) error {
+		for _,a := range m {
+			if err := unput(tx,bktGroups,kindGroup,groupKey(a.Group,a.Num)) ; err!=nil { return err }
+			if err := putGroup(tx,a.Group,a.Num,a.Msgid,a.Expire) ; err!=nil { return err }
+		}
+		return nil
+	})
+}
@@ -37,3 +37,80 @@ type BucketDatabase interface{
 	QueryGroupList(group []byte, first, last int64, targ func(num int64, bucket, msgid bufferex.Binary)) error
 }
 
+// Optional interface, implemented by BucketDatabases, that can move an article into another bucket.
+type IDMappingUpdater interface{
+	UpdateIDMapping(msgid, bucket []byte) error
+}
+
+/*
+Optional interface, implemented by BucketDatabases, that can enumerate their ID mappings in the
+order of the message-IDs, starting after 'after' (or at the beginning, if 'after' is empty), until targ returns false.
+*/
+type IDMappingLister interface{
+	ListIDMappings(after []byte, targ func(msgid, bucket []byte, expire time.Time) bool) error
+}
+
+// Optional interface, implemented by BucketDatabases, that can remove a single ID mapping.
+type IDMappingDeleter interface{
+	DeleteIDMapping(msgid []byte) error
+}
+
+/*
+Optional interface, implemented by BucketDatabases, that can insert the ID mapping and all group
+mappings of an article within one transaction: either all of them are inserted, or none.
+*/
+type MappingInserter interface{
+	InsertMappings(msgid, bucket []byte, groups [][]byte, nums []int64, expire time.Time) error
+}
+
+// Optional interface, implemented by BucketDatabases, that can remove a single group mapping.
+type GroupMappingDeleter interface{
+	DeleteGroupMapping(group []byte, num int64, msgid []byte) error
+}
+
+// The ID mapping and the group mappings of one article.
+type Mappings struct{
+	Msgid, Bucket []byte
+	Groups        [][]byte
+	Nums          []int64
+	Expire        time.Time
+}
+
+/*
+Optional interface, implemented by BucketDatabases, that can insert the mappings of many articles
+at once (eg. when importing or migrating). Either all of them are inserted, or none.
+*/
+type BatchMappingInserter interface{
+	InsertMappingsBatch(m []Mappings) error
+}
+
+/*
+Optional interface, implemented by BucketDatabases, that can enumerate their group mappings in the
+order of (group, number), starting after (group, num) (or at the beginning, if group is empty),
+until targ returns false.
+*/
+type GroupMappingLister interface{
+	ListGroupMappings(group []byte, num int64, targ func(group []byte, num int64, msgid []byte, expire time.Time) bool) error
+}
+
+type IDMapping struct{
+	Msgid, Bucket []byte
+	Expire        time.Time
+}
+
+type GroupMapping struct{
+	Group  []byte
+	Num    int64
+	Msgid  []byte
+	Expire time.Time
+}
+
+/*
+Optional interface, implemented by BucketDatabases, that can import the mappings exported by another
+BucketDatabase (see IDMappingLister and GroupMappingLister). Each call is atomic. Existing mappings
+are overwritten, so that an interrupted import can be repeated.
+*/
+type MappingImporter interface{
+	ImportIDMappings(m []IDMapping) error
+	ImportGroupMappings(m []GroupMapping) error
+}
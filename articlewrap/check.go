@@ -0,0 +1,74 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package articlewrap
+
+import "bytes"
+import "fmt"
+import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore"
+
+var ENoMapping = fmt.Errorf("E-No-Mapping")         // The object exists in a bucket, but the BucketDatabase doesn't know it.
+var EWrongBucket = fmt.Errorf("E-Wrong-Bucket")     // The BucketDatabase maps the article to a different bucket.
+var EMissingObject = fmt.Errorf("E-Missing-Object") // The BucketDatabase maps the article to a bucket, that doesn't hold it.
+
+/*
+Checks, whether the bucket, the article is mapped to, really holds it. Returns nil, if the
+article is either consistent or unknown to the BucketDatabase, EMissingObject, if the object is missing.
+*/
+func (adb *ArticleDirectBackend) ArticleDirectCheck(id []byte) (st bucketstore.ObjectStat, err error) {
+	bin,err := adb.Bdb.QueryIDMapping(id)
+	defer bin.Free()
+	if err!=nil || len(bin.Bytes())==0 { return }
+	st,ok,err := bucketstore.OverStat(adb.Store,bin.Bytes(),id)
+	if err==nil && !ok { err = EMissingObject }
+	return
+}
+
+/*
+Scans a bucket and checks every object against the BucketDatabase. report is called for every
+inconsistent object, with either ENoMapping or EWrongBucket. The store must implement
+bucketstore.OverScanner.
+*/
+func (adb *ArticleDirectBackend) ArticleDirectCheckBucket(bucket []byte, report func(id []byte, problem error)) error {
+	var token []byte
+	for {
+		ents,next,err := bucketstore.OverScan(adb.Store,bucket,token,bucketstore.ScanFilter{},0)
+		if err!=nil { return err }
+		for _,ent := range ents {
+			bin,err := adb.Bdb.QueryIDMapping(ent.Id)
+			switch {
+			case err!=nil:
+				bin.Free()
+				return err
+			case len(bin.Bytes())==0:
+				report(ent.Id,ENoMapping)
+			case !bytes.Equal(bin.Bytes(),bucket):
+				report(ent.Id,EWrongBucket)
+			}
+			bin.Free()
+		}
+		if next==nil { return nil }
+		token = next
+	}
+}
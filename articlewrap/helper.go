@@ -30,12 +30,18 @@ import "github.com/vmihailenco/msgpack"
 import "sync"
 import "github.com/maxymania/fastnntp-polyglot/buffer"
 import "fmt"
+import "github.com/maxymania/fastnntp-polyglot-labs/policies_ex"
 
 var EBufferTooLarge = fmt.Errorf("E-Buffer-Too-Large")
 
 var flatePool sync.Pool
 
+func isRaw(data []byte) bool {
+	return len(data)>0 && data[0]==policies_ex.RawMarker
+}
+
 func zunmarshal(data []byte,v... interface{}) error {
+	if isRaw(data) { return msgpack.Unmarshal(data[1:],v...) }
 	var r io.ReadCloser
 	d := bytes.NewReader(data)
 	ir := flatePool.Get()
@@ -51,6 +57,11 @@ func zunmarshal(data []byte,v... interface{}) error {
 }
 
 func zdecode(data []byte) (*[]byte,[]byte,error) {
+	if isRaw(data) {
+		tb := buffer.Get(len(data)-1)
+		if tb==nil { return nil,nil,EBufferTooLarge }
+		return tb,(*tb)[:copy(*tb,data[1:])],nil
+	}
 	var r io.ReadCloser
 	d := bytes.NewReader(data)
 	ir := flatePool.Get()
@@ -71,7 +82,7 @@ func zdecode(data []byte) (*[]byte,[]byte,error) {
 		if e!=nil { buffer.Put(tb) ; return nil,nil,e }
 		if wegot==len(*tb) {
 			ntb := buffer.Get(len(*tb)*2)
-			if ntb!=nil { buffer.Put(tb) ; return nil,nil,EBufferTooLarge }
+			if ntb==nil { buffer.Put(tb) ; return nil,nil,EBufferTooLarge }
 			copy(*ntb,*tb)
 			buffer.Put(tb)
 			tb = ntb
@@ -80,3 +91,84 @@ func zdecode(data []byte) (*[]byte,[]byte,error) {
 	
 	return tb,(*tb)[:wegot],nil
 }
+
+// Decompresses the stream r into w incrementally, without buffering the whole output.
+func zdecodeTo(w io.Writer, data io.Reader) (int64,error) {
+	var mark [1]byte
+	if _,e := io.ReadFull(data,mark[:]) ; e!=nil { return 0,e }
+	if mark[0]==policies_ex.RawMarker { return io.Copy(w,data) }
+	data = io.MultiReader(bytes.NewReader(mark[:]),data)
+	var r io.ReadCloser
+	ir := flatePool.Get()
+	if ir==nil {
+		r  = flate.NewReader(data)
+	} else {
+		ir.(flate.Resetter).Reset(data,nil)
+		r = ir.(io.ReadCloser)
+	}
+	defer flatePool.Put(r)
+	return io.Copy(w,r)
+}
+
+var errRangeDone = fmt.Errorf("E-Range-Done")
+
+type rangeWriter struct{
+	w          io.Writer
+	skip, left int64
+}
+func (r *rangeWriter) Write(p []byte) (int,error) {
+	n := len(p)
+	if r.skip>=int64(n) { r.skip -= int64(n) ; return n,nil }
+	p = p[r.skip:]
+	r.skip = 0
+	if int64(len(p))>=r.left {
+		_,e := r.w.Write(p[:r.left])
+		r.left = 0
+		if e==nil { e = errRangeDone }
+		return n,e
+	}
+	r.left -= int64(len(p))
+	_,e := r.w.Write(p)
+	return n,e
+}
+
+// Like zdecodeTo, but only writes length bytes starting at off. Decoding stops after the range.
+func zdecodeRangeTo(w io.Writer, data io.Reader, off, length int64) error {
+	if length<0 { length = 1<<62 }
+	_,e := zdecodeTo(&rangeWriter{w,off,length},data)
+	if e==errRangeDone { e = nil }
+	return e
+}
+
+/*
+Decodes a stored head (as written by ArticlePostingPost) and returns the groups listed in
+its Newsgroups header.
+*/
+func StoredNewsgroups(head []byte) ([][]byte,error) {
+	tb,h,err := zdecode(head)
+	if err!=nil { return nil,err }
+	defer buffer.Put(tb)
+	
+	var value []byte
+	found := false
+	for _,line := range bytes.Split(h,[]byte("\n")) {
+		line = bytes.TrimRight(line,"\r")
+		if len(line)==0 { break } // End of head.
+		if line[0]==' ' || line[0]=='\t' {
+			if found { value = append(value,line...) }
+			continue
+		}
+		if found { break }
+		if len(line)>=11 && bytes.EqualFold(line[:11],[]byte("Newsgroups:")) {
+			found = true
+			value = append(value,line[11:]...)
+		}
+	}
+	
+	var groups [][]byte
+	for _,g := range bytes.Split(value,[]byte(",")) {
+		g = bytes.TrimSpace(g)
+		if len(g)>0 { groups = append(groups,g) }
+	}
+	return groups,nil
+}
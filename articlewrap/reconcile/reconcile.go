@@ -0,0 +1,249 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+/*
+Cross-check and repair between a BucketDatabase and the buckets.
+
+Two kinds of inconsistencies are found:
+ - Dangling mappings: The BucketDatabase maps an article to a bucket, that doesn't hold it,
+   eg. because the bucket expired earlier than the database.
+ - Unindexed articles: A bucket holds an article, that the BucketDatabase doesn't know,
+   eg. because Submit succeeded, but InsertIDMapping failed.
+
+Unindexed articles can be re-indexed: if a group database is given, the article is numbered
+again in the groups of its Newsgroups header, otherwise only the ID mapping is restored.
+
+Expired mappings and objects are skipped, they are removed by Expire anyway. Articles mapped
+to a different bucket are not reported either: tiering.Tierer leaves those behind for a while.
+*/
+package reconcile
+
+import "errors"
+import "time"
+import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore"
+import "github.com/maxymania/fastnntp-polyglot-labs/bufferex"
+import "github.com/maxymania/fastnntp-polyglot-labs/articlewrap"
+
+var EDangling = errors.New("Dangling ID mapping")
+var EUnindexed = errors.New("Unindexed article")
+
+type Action int
+const (
+	ReportOnly Action = iota
+	Reindex // Unindexed articles: insert the missing mappings (see Reconciler.Groups).
+	Remove  // Dangling mappings: delete the mapping. Unindexed articles: delete the object.
+)
+
+type Result struct{
+	Mappings  int64 // ID mappings checked.
+	Objects   int64 // Objects checked.
+	Dangling  int64 // Dangling mappings found.
+	Unindexed int64 // Unindexed articles found.
+	Repaired  int64 // Inconsistencies repaired.
+	Failed    int64 // Repairs, that failed.
+	Skipped   int64 // ID mappings not checked, because their bucket is unavailable.
+}
+
+// The part of a group database, that allocates article numbers.
+type GroupHeadDB interface{
+	GroupHeadInsert(groups [][]byte, buf []int64) ([]int64, error)
+	GroupHeadRevert(groups [][]byte, nums []int64) error
+}
+
+type Reconciler struct{
+	Bdb     articlewrap.BucketDatabase // Must implement articlewrap.IDMappingLister to find dangling mappings.
+	Store   bucketstore.OverStore      // Must implement bucketstore.OverScanner to find unindexed articles.
+	Buckets [][]byte                   // The buckets to be scanned for unindexed articles.
+	
+	Dangling  Action // ReportOnly or Remove (requires articlewrap.IDMappingDeleter).
+	Unindexed Action // ReportOnly, Reindex or Remove (requires bucketstore.OverDeleter).
+	
+	/*
+	Optional. Used by Reindex to number the article again in its groups. If nil, Reindex
+	only restores the ID mapping, and the article stays invisible in its groups.
+	*/
+	Groups GroupHeadDB
+	
+	/*
+	Objects stored less than MinAge ago are skipped, as their posting might not be complete.
+	Default: 10 minutes. Objects of unknown age count as old.
+	*/
+	MinAge time.Duration
+	
+	Rate int // Optional. Max. checks per second.
+	
+	Report func(id, bucket []byte, problem error) // Optional. Called for every inconsistency.
+}
+
+type limiter struct{
+	start time.Time
+	n     int64
+}
+func (r *Reconciler) throttle(l *limiter) {
+	if r.Rate<=0 { return }
+	l.n++
+	d := time.Duration(l.n)*time.Second/time.Duration(r.Rate)
+	if d -= time.Since(l.start) ; d>0 { time.Sleep(d) }
+}
+
+func (r *Reconciler) report(id, bucket []byte, problem error) {
+	if r.Report!=nil { r.Report(id,bucket,problem) }
+}
+func (r *Reconciler) repaired(res *Result, err error) {
+	if err!=nil { res.Failed++ } else { res.Repaired++ }
+}
+
+/*
+Walks the ID mappings and looks up each article in its bucket. Mappings into buckets, that
+are currently unavailable, are skipped rather than reported, as their bucket might just be offline.
+*/
+func (r *Reconciler) CheckMappings(res *Result) error {
+	lst,ok := r.Bdb.(articlewrap.IDMappingLister)
+	if !ok { return bucketstore.ENotSupported }
+	del,_ := r.Bdb.(articlewrap.IDMappingDeleter)
+	if r.Dangling==Remove && del==nil { return bucketstore.ENotSupported }
+	
+	avail := make(map[string]bool)
+	l := &limiter{start:time.Now()}
+	now := time.Now()
+	var ferr error
+	err := lst.ListIDMappings(nil,func(msgid, bucket []byte, expire time.Time) bool {
+		if !expire.After(now) { return true }
+		a,known := avail[string(bucket)]
+		if !known {
+			_,e := r.Store.OverFreeStorage(bucket)
+			a = e==nil
+			avail[string(bucket)] = a
+		}
+		if !a { res.Skipped++ ; return true }
+		
+		res.Mappings++
+		_,ok,e := bucketstore.OverStat(r.Store,bucket,msgid)
+		r.throttle(l)
+		if e!=nil { ferr = e ; return false }
+		if ok { return true }
+		
+		res.Dangling++
+		r.report(msgid,bucket,EDangling)
+		if r.Dangling==Remove { r.repaired(res,del.DeleteIDMapping(msgid)) }
+		return true
+	})
+	if err==nil { err = ferr }
+	return err
+}
+
+// Scans a bucket and looks up each article in the BucketDatabase.
+func (r *Reconciler) CheckBucket(bucket []byte, res *Result) error {
+	del,_ := r.Store.(bucketstore.OverDeleter)
+	if r.Unindexed==Remove && del==nil { return bucketstore.ENotSupported }
+	
+	minAge := r.MinAge
+	if minAge<=0 { minAge = 10*time.Minute }
+	
+	l := &limiter{start:time.Now()}
+	now := time.Now()
+	var token []byte
+	for {
+		ents,next,err := bucketstore.OverScan(r.Store,bucket,token,bucketstore.ScanFilter{},0)
+		if err!=nil { return err }
+		for _,ent := range ents {
+			if !ent.Expire.After(now) { continue }
+			if !ent.Stored.IsZero() && now.Sub(ent.Stored)<minAge { continue }
+			
+			res.Objects++
+			bin,err := r.Bdb.QueryIDMapping(ent.Id)
+			found := len(bin.Bytes())>0
+			bin.Free()
+			r.throttle(l)
+			if err!=nil { return err }
+			if found { continue }
+			
+			res.Unindexed++
+			r.report(ent.Id,bucket,EUnindexed)
+			switch r.Unindexed {
+			case Reindex: r.repaired(res,r.reindex(bucket,ent))
+			case Remove: r.repaired(res,del.OverDelete(bucket,ent.Id))
+			}
+		}
+		if next==nil { return nil }
+		token = next
+	}
+}
+
+/*
+Inserts the mappings of an unindexed article. The groups are numbered one by one, so groups, that
+are not carried (anymore), are skipped.
+*/
+func (r *Reconciler) reindex(bucket []byte, ent bucketstore.ScanEntry) error {
+	if r.Groups==nil { return r.Bdb.InsertIDMapping(ent.Id,bucket,ent.Expire) }
+	
+	var head bufferex.Binary
+	ok,err := r.Store.OverGet(bucket,ent.Id,nil,&head,nil)
+	defer head.Free()
+	if err!=nil { return err }
+	if !ok { return articlewrap.EMissingObject }
+	ngs,err := articlewrap.StoredNewsgroups(head.Bytes())
+	if err!=nil { return err }
+	
+	var groups [][]byte
+	var nums []int64
+	for _,g := range ngs {
+		num,e := r.Groups.GroupHeadInsert([][]byte{g},nil)
+		if e!=nil || len(num)!=1 { continue }
+		groups = append(groups,g)
+		nums = append(nums,num[0])
+	}
+	_,err = articlewrap.InsertMappings(r.Bdb,ent.Id,bucket,groups,nums,ent.Expire)
+	if err!=nil && len(groups)>0 { r.Groups.GroupHeadRevert(groups,nums) }
+	return err
+}
+
+/*
+Performs one pass: first over the ID mappings, then over the buckets. The pass continues with the
+next bucket, if a bucket can't be scanned; the first error is returned along with the result.
+*/
+func (r *Reconciler) Run() (*Result,error) {
+	res := new(Result)
+	err := r.CheckMappings(res)
+	for _,bucket := range r.Buckets {
+		if e := r.CheckBucket(bucket,res) ; err==nil { err = e }
+	}
+	return res,err
+}
+
+/*
+Runs a pass every interval, until stop is closed. done (optional) receives the result of every pass.
+*/
+func (r *Reconciler) Loop(interval time.Duration, stop <-chan struct{}, done func(*Result,error)) {
+	tk := time.NewTicker(interval)
+	defer tk.Stop()
+	for {
+		res,err := r.Run()
+		if done!=nil { done(res,err) }
+		select {
+		case <-stop: return
+		case <-tk.C:
+		}
+	}
+}
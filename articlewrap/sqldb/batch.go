@@ -0,0 +1,115 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package sqldb
+
+import "bytes"
+import "database/sql"
+import "strconv"
+import "github.com/maxymania/fastnntp-polyglot-labs/articlewrap"
+import "github.com/maxymania/fastnntp-polyglot-labs/util/sqlutil"
+
+const (
+	tIDs    = "msgidbkt (msgid,bucket,expir)"
+	tGroups = "ngrpnumvalue (ngrp,mnum,msgid,expir)"
+)
+
+// Rows per INSERT or COPY. Keeps the number of parameters below the limits of the databases.
+const batchRows = 256
+
+// Inserts len(args)/ncols rows with a single multi-row INSERT.
+func (b *Base) insertRows(tx *sql.Tx, table string, ncols int, args []interface{}) error {
+	if len(args)==0 { return nil }
+	q := new(bytes.Buffer)
+	q.WriteString("INSERT INTO "+table+" VALUES ")
+	for i := 0 ; i<len(args) ; i += ncols {
+		if i>0 { q.WriteByte(',') }
+		q.WriteByte('(')
+		for j := 1 ; j<=ncols ; j++ {
+			if j>1 { q.WriteByte(',') }
+			q.WriteString("$"+strconv.Itoa(i+j))
+		}
+		q.WriteByte(')')
+	}
+	q.WriteByte(';')
+	_,err := b.Dialect.Exec(tx,q.String(),args...)
+	return err
+}
+
+/*
+Inserts len(args)/ncols rows with COPY. This uses the COPY protocol of github.com/lib/pq:
+Exec sends one row, the final Exec without arguments completes the COPY.
+*/
+func (b *Base) copyRows(tx *sql.Tx, table string, ncols int, args []interface{}) error {
+	if len(args)==0 { return nil }
+	s,err := tx.Prepare("COPY "+table+" FROM STDIN")
+	if err!=nil { return err }
+	defer s.Close()
+	for i := 0 ; i<len(args) ; i += ncols {
+		if _,err = s.Exec(args[i:i+ncols]...) ; err!=nil { return err }
+	}
+	_,err = s.Exec()
+	return err
+}
+
+// Returns copyRows, if b.Copy is set (PostgreSQL only), insertRows otherwise.
+func (b *Base) inserter() func(tx *sql.Tx, table string, ncols int, args []interface{}) error {
+	if b.Copy && b.Dialect.Def()==sqlutil.PgDialect { return b.copyRows }
+	return b.insertRows
+}
+
+/*
+Implements articlewrap.BatchMappingInserter. All mappings are inserted within one transaction,
+using multi-row INSERTs, or COPY, if b.Copy is set (PostgreSQL only).
+*/
+func (b *Base) InsertMappingsBatch(m []articlewrap.Mappings) (err error) {
+	insert := b.inserter()
+	
+	tx,err := b.DB.Begin()
+	if err!=nil { return }
+	defer func() {
+		if err!=nil { tx.Rollback() ; return }
+		err = tx.Commit()
+	}()
+	ids := make([]interface{},0,batchRows*3)
+	grps := make([]interface{},0,batchRows*4)
+	for i := range m {
+		a := &m[i]
+		ids = append(ids,a.Msgid,a.Bucket,a.Expire)
+		if len(ids)==cap(ids) {
+			if err = insert(tx,tIDs,3,ids) ; err!=nil { return }
+			ids = ids[:0]
+		}
+		for j,group := range a.Groups {
+			grps = append(grps,group,a.Nums[j],a.Msgid,a.Expire)
+			if len(grps)==cap(grps) {
+				if err = insert(tx,tGroups,4,grps) ; err!=nil { return }
+				grps = grps[:0]
+			}
+		}
+	}
+	if err = insert(tx,tIDs,3,ids) ; err!=nil { return }
+	err = insert(tx,tGroups,4,grps)
+	return
+}
@@ -0,0 +1,129 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package sqldb
+
+import "bytes"
+import "database/sql"
+import "strconv"
+import "time"
+import "github.com/maxymania/fastnntp-polyglot-labs/articlewrap"
+
+type groupMapping struct{
+	group []byte
+	num   int64
+	msgid []byte
+	expire time.Time
+}
+
+/*
+Implements articlewrap.GroupMappingLister. The table is read page by page, so that no query is
+kept open while targ runs.
+*/
+func (b *Base) ListGroupMappings(group []byte, num int64, targ func(group []byte, num int64, msgid []byte, expire time.Time) bool) error {
+	page := make([]groupMapping,0,idMappingPage)
+	last := append([]byte{},group...) // non-nil: NULL would match nothing.
+	for {
+		page = page[:0]
+		res,err := b.query(sListGroup,last,last,num)
+		if err!=nil { return err }
+		var ent groupMapping
+		for res.Next() {
+			if err = res.Scan(&ent.group,&ent.num,&ent.msgid,&ent.expire) ; err!=nil { break }
+			page = append(page,ent)
+		}
+		if err==nil { err = res.Err() }
+		res.Close()
+		if err!=nil { return err }
+		if len(page)==0 { return nil }
+		for _,ent := range page {
+			if !targ(ent.group,ent.num,ent.msgid,ent.expire) { return nil }
+		}
+		last,num = page[len(page)-1].group,page[len(page)-1].num
+	}
+}
+
+// Deletes the rows, whose columns cols match one of the keys (len(cols) values per row).
+func (b *Base) deleteRows(tx *sql.Tx, table string, cols []string, keys []interface{}) error {
+	if len(keys)==0 { return nil }
+	q := new(bytes.Buffer)
+	q.WriteString("DELETE FROM "+table+" WHERE ")
+	for i := 0 ; i<len(keys) ; i += len(cols) {
+		if i>0 { q.WriteString(" OR ") }
+		q.WriteByte('(')
+		for j,col := range cols {
+			if j>0 { q.WriteString(" AND ") }
+			q.WriteString(col+"=$"+strconv.Itoa(i+j+1))
+		}
+		q.WriteByte(')')
+	}
+	q.WriteByte(';')
+	_,err := b.Dialect.Exec(tx,q.String(),keys...)
+	return err
+}
+
+func finish(tx *sql.Tx, err error) error {
+	if err!=nil { tx.Rollback() ; return err }
+	return tx.Commit()
+}
+
+// Implements articlewrap.MappingImporter.
+func (b *Base) ImportIDMappings(m []articlewrap.IDMapping) error {
+	tx,err := b.DB.Begin()
+	if err!=nil { return err }
+	for len(m)>0 && err==nil {
+		n := len(m)
+		if n>batchRows { n = batchRows }
+		keys := make([]interface{},0,n)
+		args := make([]interface{},0,n*3)
+		for _,a := range m[:n] {
+			keys = append(keys,a.Msgid)
+			args = append(args,a.Msgid,a.Bucket,a.Expire)
+		}
+		m = m[n:]
+		err = b.deleteRows(tx,"msgidbkt",[]string{"msgid"},keys)
+		if err==nil { err = b.inserter()(tx,tIDs,3,args) }
+	}
+	return finish(tx,err)
+}
+
+// Implements articlewrap.MappingImporter.
+func (b *Base) ImportGroupMappings(m []articlewrap.GroupMapping) error {
+	tx,err := b.DB.Begin()
+	if err!=nil { return err }
+	for len(m)>0 && err==nil {
+		n := len(m)
+		if n>batchRows { n = batchRows }
+		keys := make([]interface{},0,n*2)
+		args := make([]interface{},0,n*4)
+		for _,a := range m[:n] {
+			keys = append(keys,a.Group,a.Num)
+			args = append(args,a.Group,a.Num,a.Msgid,a.Expire)
+		}
+		m = m[n:]
+		err = b.deleteRows(tx,"ngrpnumvalue",[]string{"ngrp","mnum"},keys)
+		if err==nil { err = b.inserter()(tx,tGroups,4,args) }
+	}
+	return finish(tx,err)
+}
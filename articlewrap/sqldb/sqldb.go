@@ -27,6 +27,7 @@ import "database/sql"
 import "text/template"
 import "bytes"
 import "time"
+import "sync"
 import "github.com/maxymania/fastnntp-polyglot-labs/bufferex"
 import "github.com/maxymania/fastnntp-polyglot-labs/util/sqlutil"
 
@@ -64,44 +65,126 @@ var createTables = template.Must(template.New("create").Parse(`
 	);
 `))
 
+/*
+The statements are prepared once, on their first use. Base must not be copied after its first use.
+*/
 type Base struct{
-	DB *sql.DB
+	DB      *sql.DB
+	Dialect *sqlutil.Dialect // nil = PostgreSQL
+	
+	// PostgreSQL with github.com/lib/pq only: InsertMappingsBatch uses COPY instead of INSERT.
+	Copy    bool
+	
+	mu    sync.RWMutex
+	stmts [nStmts]*sql.Stmt
+}
+
+var Schema = &sqlutil.Schema{
+	Model: "sqldb",
+	Probe: "msgidbkt",
+	Migrations: []sqlutil.Migration{
+		{Version: 1, Name: "create tables", SQL: createTables},
+		{Version: 2, Name: "expiry indexes", SQL: createIndexes},
+	},
 }
 
+var createIndexes = template.Must(template.New("index").Parse(`
+	CREATE INDEX ngrpnumvalue_expir ON ngrpnumvalue (expir);
+	CREATE INDEX msgidbkt_expir ON msgidbkt (expir);
+`))
+
+func (b *Base) SqlSchema() *sqlutil.Schema { return Schema }
+
 func (b *Base) CreateSqlModel(d *sqlutil.Dialect) error {
-	buf := new(bytes.Buffer)
-	createTables.Execute(buf, d)
-	_,err := b.DB.Exec(buf.String())
+	_,err := Schema.Migrate(b.DB,d,nil)
 	return err
 }
 func (b *Base) CreateTables(d *Dialect) error {
 	buf := new(bytes.Buffer)
 	createTables.Execute(buf, d)
-	_,err := b.DB.Exec(buf.String())
-	return err
+	return b.Dialect.ExecScript(b.DB,buf.String())
 }
 
 func (b *Base) InsertGoupMapping(group []byte, num int64, msgid []byte, expire time.Time) error {
-	_,err := b.DB.Exec(`INSERT INTO ngrpnumvalue (ngrp,mnum,msgid,expir) VALUES ($1,$2,$3,$4);`,group,num,msgid,expire)
-	return err
+	return b.exec(sInsertGroup,group,num,msgid,expire)
 }
 func (b *Base) InsertIDMapping(msgid, bucket []byte, expire time.Time) error {
-	_,err := b.DB.Exec(`INSERT INTO msgidbkt (msgid,bucket,expir) VALUES ($1,$2,$3);`,msgid,bucket,expire)
-	return err
+	return b.exec(sInsertID,msgid,bucket,expire)
+}
+func (b *Base) UpdateIDMapping(msgid, bucket []byte) error {
+	return b.exec(sUpdateID,bucket,msgid)
+}
+/*
+Implements articlewrap.MappingInserter. The group mappings of a crossposted article are inserted
+with a single multi-row INSERT.
+*/
+func (b *Base) InsertMappings(msgid, bucket []byte, groups [][]byte, nums []int64, expire time.Time) (err error) {
+	s,err := b.stmt(sInsertID)
+	if err!=nil { return }
+	tx,err := b.DB.Begin()
+	if err!=nil { return }
+	defer func() {
+		if err!=nil { tx.Rollback() ; return }
+		err = tx.Commit()
+	}()
+	_,err = tx.Stmt(s).Exec(msgid,bucket,expire)
+	if err!=nil { return }
+	switch len(groups) {
+	case 0: return
+	case 1:
+		if s,err = b.stmt(sInsertGroup) ; err!=nil { return }
+		_,err = tx.Stmt(s).Exec(groups[0],nums[0],msgid,expire)
+		return
+	}
+	args := make([]interface{},0,len(groups)*4)
+	for i,group := range groups {
+		args = append(args,group,nums[i],msgid,expire)
+	}
+	return b.insertRows(tx,tGroups,4,args)
+}
+func (b *Base) DeleteGroupMapping(group []byte, num int64, msgid []byte) error {
+	return b.exec(sDeleteGroup,group,num,msgid)
+}
+func (b *Base) DeleteIDMapping(msgid []byte) error {
+	return b.exec(sDeleteID,msgid)
+}
+
+type idMapping struct{
+	msgid, bucket []byte
+	expire time.Time
+}
+const idMappingPage = 256
+
+/*
+Implements articlewrap.IDMappingLister. The table is read page by page, so that no query is
+kept open while targ runs.
+*/
+func (b *Base) ListIDMappings(after []byte, targ func(msgid, bucket []byte, expire time.Time) bool) error {
+	page := make([]idMapping,0,idMappingPage)
+	last := append([]byte{},after...) // non-nil: NULL would match nothing.
+	for {
+		page = page[:0]
+		res,err := b.query(sListID,last)
+		if err!=nil { return err }
+		var ent idMapping
+		for res.Next() {
+			if err = res.Scan(&ent.msgid,&ent.bucket,&ent.expire) ; err!=nil { break }
+			page = append(page,ent)
+		}
+		if err==nil { err = res.Err() }
+		res.Close()
+		if err!=nil { return err }
+		if len(page)==0 { return nil }
+		for _,ent := range page {
+			if !targ(ent.msgid,ent.bucket,ent.expire) { return nil }
+		}
+		last = page[len(page)-1].msgid
+	}
 }
 
 func (b *Base) QueryGroupMapping(group []byte, num int64) (msgid, bucket bufferex.Binary,err error) {
 	var res *sql.Rows
-	res,err = b.DB.Query(`
-	SELECT
-		m.msgid,
-		m.bucket
-	FROM
-		ngrpnumvalue n JOIN msgidbkt m ON n.msgid = m.msgid
-	WHERE
-		n.ngrp = $1 AND
-		n.mnum = $2
-	;`,group,num)
+	res,err = b.query(sQueryGroupMapping,group,num)
 	if err!=nil { return }
 	defer res.Close()
 	if !res.Next() { return }
@@ -114,14 +197,7 @@ func (b *Base) QueryGroupMapping(group []byte, num int64) (msgid, bucket buffere
 }
 func (b *Base) QueryIDMapping(msgid []byte) (bucket bufferex.Binary,err error) {
 	var res *sql.Rows
-	res,err = b.DB.Query(`
-	SELECT
-		m.bucket
-	FROM
-		msgidbkt m
-	WHERE
-		m.msgid = $1
-	;`,msgid)
+	res,err = b.query(sQueryID,msgid)
 	if err!=nil { return }
 	defer res.Close()
 	if !res.Next() { return }
@@ -134,52 +210,20 @@ func (b *Base) QueryIDMapping(msgid []byte) (bucket bufferex.Binary,err error) {
 
 func (b *Base) QueryGroupShift(group []byte, num int64, backward bool) (nxt int64,msgid bufferex.Binary,err error) {
 	var res *sql.Rows
-	aggr,comp := "min",">"
-	if backward { aggr,comp = "max","<" }
-	res,err = b.DB.Query(`
-	SELECT
-		`+aggr+`(n.mnum)
-	FROM
-		ngrpnumvalue n
-	WHERE
-		n.ngrp = $1 AND n.mnum `+comp+` $2
-	;`,group,num)
-	if err!=nil { return }
-	if !res.Next() { res.Close() ; return }
-	err = res.Scan(&nxt)
-	res.Close()
-	if err!=nil { return }
-	
-	res,err = b.DB.Query(`
-	SELECT
-		n.msgid
-	FROM
-		ngrpnumvalue n
-	WHERE
-		n.ngrp = $1 AND n.mnum = $2
-	;`,group,nxt)
+	id := sShiftForward
+	if backward { id = sShiftBackward }
+	res,err = b.query(id,group,num)
 	if err!=nil { return }
 	defer res.Close()
-	
-	if !res.Next() { nxt = 0 ; return }
+	if !res.Next() { return }
 	var rmsgid sql.RawBytes
-	err = res.Scan(&rmsgid)
-	if err!=nil { return }
+	err = res.Scan(&nxt,&rmsgid)
+	if err!=nil { nxt = 0 ; return }
 	msgid = bufferex.NewBinary(rmsgid)
 	return
 }
 func (b *Base) QueryGroupList(group []byte, first, last int64, targ func(num int64, bucket, msgid bufferex.Binary)) error {
-	row,err := b.DB.Query(`
-		SELECT
-			n.mnum,
-			m.bucket,
-			m.msgid
-		FROM
-			ngrpnumvalue n LEFT OUTER JOIN msgidbkt m
-			ON n.msgid = m.msgid
-		WHERE
-			n.ngrp = $1 AND n.mnum >= $2 AND n.mnum <= $3
-	;`,group,first,last)
+	row,err := b.query(sGroupList,group,first,last)
 	if err!=nil { return err }
 	defer row.Close()
 	var num int64
@@ -193,9 +237,8 @@ func (b *Base) QueryGroupList(group []byte, first, last int64, targ func(num int
 	return nil
 }
 func (b *Base) Expire(expire time.Time) error {
-	_,e1 := b.DB.Exec(`DELETE FROM ngrpnumvalue n WHERE n.expir <= $1 ;`,expire)
-	_,e2 := b.DB.Exec(`DELETE FROM msgidbkt m WHERE m.expir <= $1 ;`,expire)
+	e1 := b.exec(sExpireGroup,expire)
+	e2 := b.exec(sExpireID,expire)
 	if e1==nil { e1=e2 }
 	return e1
 }
-
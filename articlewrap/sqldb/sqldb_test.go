@@ -0,0 +1,255 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+
+package sqldb
+
+import "database/sql"
+import "fmt"
+import "os"
+import "testing"
+import "time"
+import _ "github.com/lib/pq"
+import "github.com/maxymania/fastnntp-polyglot-labs/articlewrap"
+import "github.com/maxymania/fastnntp-polyglot-labs/util/sqlutil"
+
+/*
+The benchmarks run against the PostgreSQL database given by $SQLDB_TEST_DSN, and are skipped
+if it is not set. The model is installed, if necessary. All rows written are removed afterwards.
+The *Legacy benchmarks measure the previous implementation, which executed the raw SQL text for
+every call and needed two queries for QueryGroupShift.
+
+	SQLDB_TEST_DSN=postgres://... go test -run - -bench . ./articlewrap/sqldb
+*/
+const benchDSN = "SQLDB_TEST_DSN"
+
+const benchGroups = 3
+
+var benchBucket = []byte("sqldbbench")
+
+type bench struct{
+	*Base
+	run    string
+	expire time.Time
+}
+
+func openBench(b *testing.B) *bench {
+	dsn := os.Getenv(benchDSN)
+	if dsn=="" { b.Skip(benchDSN+" not set") }
+	db,err := sql.Open("postgres",dsn)
+	if err==nil { _,err = Schema.Migrate(db,sqlutil.PgDialect,nil) }
+	if err!=nil { b.Fatal(err) }
+	/* Every call gets its own rows, as a benchmark function is run several times. */
+	run := fmt.Sprint(time.Now().UnixNano())
+	return &bench{&Base{DB:db},run,time.Now().AddDate(0,0,1)}
+}
+
+func (t *bench) close() {
+	t.DB.Exec(`DELETE FROM ngrpnumvalue WHERE ngrp LIKE $1;`,[]byte("sqldbbench."+t.run+".%"))
+	t.DB.Exec(`DELETE FROM msgidbkt WHERE msgid LIKE $1;`,[]byte("<%."+t.run+"@sqldbbench>"))
+	t.Close()
+	t.DB.Close()
+}
+
+func (t *bench) article(i int) articlewrap.Mappings {
+	m := articlewrap.Mappings{
+		Msgid: []byte(fmt.Sprintf("<%d.%s@sqldbbench>",i,t.run)),
+		Bucket: benchBucket,
+		Expire: t.expire,
+	}
+	for g := 0 ; g<benchGroups ; g++ {
+		m.Groups = append(m.Groups,[]byte(fmt.Sprintf("sqldbbench.%s.%d",t.run,g)))
+		m.Nums = append(m.Nums,int64(i+1))
+	}
+	return m
+}
+
+// Inserts n articles.
+func (t *bench) fill(b *testing.B, n int) {
+	batch := make([]articlewrap.Mappings,0,batchRows)
+	for i := 0 ; i<n ; i++ {
+		batch = append(batch,t.article(i))
+		if len(batch)<cap(batch) && i<n-1 { continue }
+		if err := t.InsertMappingsBatch(batch) ; err!=nil { b.Fatal(err) }
+		batch = batch[:0]
+	}
+}
+
+/* ------------------------------------ previous implementation ------------------------------------ */
+
+func (t *bench) legacyInsert(m articlewrap.Mappings) error {
+	_,err := t.DB.Exec(`INSERT INTO msgidbkt (msgid,bucket,expir) VALUES ($1,$2,$3);`,m.Msgid,m.Bucket,m.Expire)
+	if err!=nil { return err }
+	for i,group := range m.Groups {
+		_,err = t.DB.Exec(`INSERT INTO ngrpnumvalue (ngrp,mnum,msgid,expir) VALUES ($1,$2,$3,$4);`,group,m.Nums[i],m.Msgid,m.Expire)
+		if err!=nil { return err }
+	}
+	return nil
+}
+
+func (t *bench) legacyMapping(group []byte, num int64) error {
+	res,err := t.DB.Query(`
+	SELECT
+		m.msgid,
+		m.bucket
+	FROM
+		ngrpnumvalue n JOIN msgidbkt m ON n.msgid = m.msgid
+	WHERE
+		n.ngrp = $1 AND
+		n.mnum = $2
+	;`,group,num)
+	if err!=nil { return err }
+	defer res.Close()
+	if !res.Next() { return fmt.Errorf("mapping not found") }
+	var rmsgid,rbucket sql.RawBytes
+	return res.Scan(&rmsgid,&rbucket)
+}
+
+func (t *bench) legacyShift(group []byte, num int64) error {
+	var nxt int64
+	res,err := t.DB.Query(`
+	SELECT
+		min(n.mnum)
+	FROM
+		ngrpnumvalue n
+	WHERE
+		n.ngrp = $1 AND n.mnum > $2
+	;`,group,num)
+	if err!=nil { return err }
+	if !res.Next() { res.Close() ; return nil }
+	err = res.Scan(&nxt)
+	res.Close()
+	if err!=nil { return err }
+	res,err = t.DB.Query(`
+	SELECT
+		n.msgid
+	FROM
+		ngrpnumvalue n
+	WHERE
+		n.ngrp = $1 AND n.mnum = $2
+	;`,group,nxt)
+	if err!=nil { return err }
+	defer res.Close()
+	res.Next()
+	return nil
+}
+
+/* ------------------------------------------------------------------------------------------------- */
+
+func BenchmarkInsertMappingsLegacy(b *testing.B) {
+	t := openBench(b)
+	defer t.close()
+	b.ResetTimer()
+	for i := 0 ; i<b.N ; i++ {
+		if err := t.legacyInsert(t.article(i)) ; err!=nil { b.Fatal(err) }
+	}
+}
+
+func BenchmarkInsertMappings(b *testing.B) {
+	t := openBench(b)
+	defer t.close()
+	b.ResetTimer()
+	for i := 0 ; i<b.N ; i++ {
+		m := t.article(i)
+		if err := t.InsertMappings(m.Msgid,m.Bucket,m.Groups,m.Nums,m.Expire) ; err!=nil { b.Fatal(err) }
+	}
+}
+
+func benchmarkBatch(b *testing.B, useCopy bool) {
+	t := openBench(b)
+	defer t.close()
+	t.Copy = useCopy
+	batch := make([]articlewrap.Mappings,0,batchRows)
+	b.ResetTimer()
+	for i := 0 ; i<b.N ; i++ {
+		batch = append(batch,t.article(i))
+		if len(batch)<cap(batch) && i<b.N-1 { continue }
+		if err := t.InsertMappingsBatch(batch) ; err!=nil { b.Fatal(err) }
+		batch = batch[:0]
+	}
+}
+
+func BenchmarkInsertMappingsBatch(b *testing.B) { benchmarkBatch(b,false) }
+func BenchmarkInsertMappingsBatchCopy(b *testing.B) { benchmarkBatch(b,true) }
+
+func BenchmarkQueryGroupMapping(b *testing.B) {
+	t := openBench(b)
+	defer t.close()
+	t.fill(b,b.N)
+	b.ResetTimer()
+	group := t.article(0).Groups[0]
+	for i := 0 ; i<b.N ; i++ {
+		msgid,bucket,err := t.QueryGroupMapping(group,int64(i+1))
+		if err!=nil { b.Fatal(err) }
+		msgid.Free()
+		bucket.Free()
+	}
+}
+
+func BenchmarkQueryGroupMappingLegacy(b *testing.B) {
+	t := openBench(b)
+	defer t.close()
+	t.fill(b,b.N)
+	b.ResetTimer()
+	group := t.article(0).Groups[0]
+	for i := 0 ; i<b.N ; i++ {
+		if err := t.legacyMapping(group,int64(i+1)) ; err!=nil { b.Fatal(err) }
+	}
+}
+
+func BenchmarkQueryIDMapping(b *testing.B) {
+	t := openBench(b)
+	defer t.close()
+	t.fill(b,b.N)
+	b.ResetTimer()
+	for i := 0 ; i<b.N ; i++ {
+		bucket,err := t.QueryIDMapping(t.article(i).Msgid)
+		if err!=nil { b.Fatal(err) }
+		bucket.Free()
+	}
+}
+
+func BenchmarkQueryGroupShift(b *testing.B) {
+	t := openBench(b)
+	defer t.close()
+	t.fill(b,b.N)
+	b.ResetTimer()
+	group := t.article(0).Groups[0]
+	for i := 0 ; i<b.N ; i++ {
+		_,msgid,err := t.QueryGroupShift(group,int64(i),false)
+		if err!=nil { b.Fatal(err) }
+		msgid.Free()
+	}
+}
+
+func BenchmarkQueryGroupShiftLegacy(b *testing.B) {
+	t := openBench(b)
+	defer t.close()
+	t.fill(b,b.N)
+	b.ResetTimer()
+	group := t.article(0).Groups[0]
+	for i := 0 ; i<b.N ; i++ {
+		if err := t.legacyShift(group,int64(i)) ; err!=nil { b.Fatal(err) }
+	}
+}
@@ -0,0 +1,203 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package sqldb
+
+import "database/sql"
+import "strconv"
+import "strings"
+import "github.com/maxymania/fastnntp-polyglot-labs/util/sqlutil"
+
+type stmtID int
+const (
+	sInsertGroup stmtID = iota
+	sInsertID
+	sUpdateID
+	sDeleteGroup
+	sDeleteID
+	sQueryGroupMapping
+	sQueryID
+	sShiftForward
+	sShiftBackward
+	sGroupList
+	sListID
+	sListGroup
+	sExpireGroup
+	sExpireID
+	nStmts
+)
+
+// The statements of Base. Every placeholder must occur once, in ascending order (see sqlutil.Rebind).
+// The TOP and LIMIT markers are replaced according to the dialect (see limit).
+var queries = [nStmts]string{
+	sInsertGroup: `INSERT INTO ngrpnumvalue (ngrp,mnum,msgid,expir) VALUES ($1,$2,$3,$4);`,
+	sInsertID: `INSERT INTO msgidbkt (msgid,bucket,expir) VALUES ($1,$2,$3);`,
+	sUpdateID: `UPDATE msgidbkt SET bucket=$1 WHERE msgid=$2;`,
+	sDeleteGroup: `DELETE FROM ngrpnumvalue WHERE ngrp=$1 AND mnum=$2 AND msgid=$3;`,
+	sDeleteID: `DELETE FROM msgidbkt WHERE msgid=$1;`,
+	sQueryGroupMapping: `
+	SELECT
+		m.msgid,
+		m.bucket
+	FROM
+		ngrpnumvalue n JOIN msgidbkt m ON n.msgid = m.msgid
+	WHERE
+		n.ngrp = $1 AND
+		n.mnum = $2
+	;`,
+	sQueryID: `
+	SELECT
+		m.bucket
+	FROM
+		msgidbkt m
+	WHERE
+		m.msgid = $1
+	;`,
+	sShiftForward: `
+	SELECT /*TOP*/
+		n.mnum,
+		n.msgid
+	FROM
+		ngrpnumvalue n
+	WHERE
+		n.ngrp = $1 AND n.mnum > $2
+	ORDER BY
+		n.mnum
+	/*LIMIT*/
+	;`,
+	sShiftBackward: `
+	SELECT /*TOP*/
+		n.mnum,
+		n.msgid
+	FROM
+		ngrpnumvalue n
+	WHERE
+		n.ngrp = $1 AND n.mnum < $2
+	ORDER BY
+		n.mnum DESC
+	/*LIMIT*/
+	;`,
+	sGroupList: `
+	SELECT
+		n.mnum,
+		m.bucket,
+		m.msgid
+	FROM
+		ngrpnumvalue n LEFT OUTER JOIN msgidbkt m
+		ON n.msgid = m.msgid
+	WHERE
+		n.ngrp = $1 AND n.mnum >= $2 AND n.mnum <= $3
+	;`,
+	sListID: `
+	SELECT /*TOP*/
+		m.msgid,
+		m.bucket,
+		m.expir
+	FROM
+		msgidbkt m
+	WHERE
+		m.msgid > $1
+	ORDER BY
+		m.msgid
+	/*LIMIT*/
+	;`,
+	sListGroup: `
+	SELECT /*TOP*/
+		n.ngrp,
+		n.mnum,
+		n.msgid,
+		n.expir
+	FROM
+		ngrpnumvalue n
+	WHERE
+		n.ngrp > $1 OR (n.ngrp = $2 AND n.mnum > $3)
+	ORDER BY
+		n.ngrp,
+		n.mnum
+	/*LIMIT*/
+	;`,
+	sExpireGroup: `DELETE FROM ngrpnumvalue WHERE expir <= $1 ;`,
+	sExpireID: `DELETE FROM msgidbkt WHERE expir <= $1 ;`,
+}
+
+// The row limit of the statements, that have one.
+var limits = [nStmts]int{
+	sShiftForward: 1,
+	sShiftBackward: 1,
+	sListID: idMappingPage,
+	sListGroup: idMappingPage,
+}
+
+func limit(q string, d *sqlutil.Dialect, n int) string {
+	if n==0 { return q }
+	ns := strconv.Itoa(n)
+	top,lim := "","LIMIT "+ns
+	if !d.Def().Limit { top,lim = "TOP "+ns,"" }
+	return strings.NewReplacer("/*TOP*/",top,"/*LIMIT*/",lim).Replace(q)
+}
+
+// Returns the prepared statement. It is prepared on the first use.
+func (b *Base) stmt(id stmtID) (*sql.Stmt, error) {
+	b.mu.RLock()
+	s := b.stmts[id]
+	b.mu.RUnlock()
+	if s!=nil { return s,nil }
+	
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if s = b.stmts[id] ; s!=nil { return s,nil }
+	s,err := b.Dialect.Prepare(b.DB,limit(queries[id],b.Dialect,limits[id]))
+	if err!=nil { return nil,err }
+	b.stmts[id] = s
+	return s,nil
+}
+
+func (b *Base) exec(id stmtID, args ...interface{}) error {
+	s,err := b.stmt(id)
+	if err!=nil { return err }
+	_,err = s.Exec(args...)
+	return err
+}
+
+func (b *Base) query(id stmtID, args ...interface{}) (*sql.Rows, error) {
+	s,err := b.stmt(id)
+	if err!=nil { return nil,err }
+	return s.Query(args...)
+}
+
+/*
+Closes the prepared statements. The Base remains usable, the statements are prepared again
+on their next use.
+*/
+func (b *Base) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var err error
+	for i,s := range b.stmts {
+		if s==nil { continue }
+		if e := s.Close() ; err==nil { err = e }
+		b.stmts[i] = nil
+	}
+	return err
+}
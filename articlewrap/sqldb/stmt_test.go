@@ -0,0 +1,57 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+
+package sqldb
+
+import "strings"
+import "testing"
+import "github.com/maxymania/fastnntp-polyglot-labs/util/sqlutil"
+
+func TestLimit(t *testing.T) {
+	const q = `SELECT /*TOP*/ a FROM t ORDER BY a /*LIMIT*/;`
+	tests := []struct{
+		d    *sqlutil.Dialect
+		n    int
+		want string
+	}{
+		{nil, 1, `SELECT  a FROM t ORDER BY a LIMIT 1;`},
+		{sqlutil.PgDialect, 256, `SELECT  a FROM t ORDER BY a LIMIT 256;`},
+		{sqlutil.SqliteDialect, 1, `SELECT  a FROM t ORDER BY a LIMIT 1;`},
+		{sqlutil.MsSqlDialect, 256, `SELECT TOP 256 a FROM t ORDER BY a ;`},
+		{sqlutil.MsSqlDialect, 0, q},
+	}
+	for _,tt := range tests {
+		if got := limit(q,tt.d,tt.n) ; got!=tt.want { t.Errorf("limit(%v,%d) = %q, want %q",tt.d,tt.n,got,tt.want) }
+	}
+}
+
+/* Every query with a limit must carry the markers, or the limit would be lost. */
+func TestLimitMarkers(t *testing.T) {
+	for id,n := range limits {
+		if n==0 { continue }
+		q := queries[id]
+		if !strings.Contains(q,"/*TOP*/") || !strings.Contains(q,"/*LIMIT*/") { t.Errorf("query %d: missing /*TOP*/ or /*LIMIT*/",id) }
+	}
+}
@@ -0,0 +1,74 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package articlewrap
+
+import "time"
+import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore"
+
+/*
+Removes the mappings inserted so far. Returns false, if the ID mapping could not be removed,
+so the stored object is still referenced.
+*/
+func revertMappings(bdb BucketDatabase, msgid []byte, groups [][]byte, nums []int64) bool {
+	if gd,ok := bdb.(GroupMappingDeleter) ; ok {
+		for i,group := range groups { gd.DeleteGroupMapping(group,nums[i],msgid) }
+	}
+	if id,ok := bdb.(IDMappingDeleter) ; ok {
+		return id.DeleteIDMapping(msgid)==nil
+	}
+	return false
+}
+
+/*
+Inserts the ID mapping and the group mappings of a stored article. If the BucketDatabase implements
+MappingInserter, all mappings are inserted atomically. Otherwise, they are inserted one by one, and
+the inserted ones are removed again on failure.
+
+On failure, unref reports, whether the stored object is no longer referenced by any mapping.
+*/
+func InsertMappings(bdb BucketDatabase, msgid, bucket []byte, groups [][]byte, nums []int64, expire time.Time) (unref bool,err error) {
+	if mi,ok := bdb.(MappingInserter) ; ok { return true,mi.InsertMappings(msgid,bucket,groups,nums,expire) }
+	
+	err = bdb.InsertIDMapping(msgid,bucket,expire)
+	if err!=nil { return true,err }
+	for i,group := range groups {
+		err = bdb.InsertGoupMapping(group,nums[i],msgid,expire)
+		if err!=nil { return revertMappings(bdb,msgid,groups[:i],nums),err }
+	}
+	return
+}
+
+/*
+Indexes a stored article (see InsertMappings).
+
+On failure, the stored object is deleted (compensation), unless it is still referenced by an ID
+mapping, that could not be removed.
+*/
+func (adb *ArticleDirectBackend) insertMappings(msgid, bucket []byte, groups [][]byte, nums []int64, expire time.Time) error {
+	unref,err := InsertMappings(adb.Bdb,msgid,bucket,groups,nums,expire)
+	if err==nil || !unref { return err }
+	if d,ok := adb.Store.(bucketstore.OverDeleter) ; ok { d.OverDelete(bucket,msgid) }
+	return err
+}
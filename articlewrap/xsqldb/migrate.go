@@ -0,0 +1,52 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package xsqldb
+
+import "database/sql"
+import "github.com/maxymania/fastnntp-polyglot-labs/util/sqlutil"
+import "github.com/maxymania/fastnntp-polyglot-labs/articlewrap/sqldb"
+import "github.com/maxymania/fastnntp-polyglot-labs/groupdb/semigroupdb"
+
+/*
+Converts a database created by this package into the "sqldb" and "semigroupdb" models.
+
+The only difference is the "gcount" column of ngrpcnt, which is removed. Afterwards, the
+"sqldb" and "semigroupdb" models are marked as installed (version 1), so that their later
+migrations can be applied.
+*/
+var Schema = &sqlutil.Schema{
+	Model: "xsqldb",
+	Migrations: []sqlutil.Migration{
+		{Version: 1, Name: "convert to sqldb and semigroupdb", Func: convert},
+	},
+}
+
+func convert(tx *sql.Tx, d *sqlutil.Dialect) error {
+	if _,err := tx.Exec(`ALTER TABLE ngrpcnt DROP COLUMN gcount;`) ; err!=nil { return err }
+	if err := sqldb.Schema.Adopt(tx,d,1) ; err!=nil { return err }
+	return semigroupdb.Schema.Adopt(tx,d,1)
+}
+
+func (b *Base) SqlSchema() *sqlutil.Schema { return Schema }
@@ -164,6 +164,42 @@ func (b *Base) InsertIDMapping(msgid, bucket []byte, expire time.Time) error {
 	_,err := b.DB.Exec(`INSERT INTO msgidbkt (msgid,bucket,expir) VALUES ($1,$2,$3);`,msgid,bucket,expire)
 	return err
 }
+// Implements articlewrap.MappingInserter. The group counters are updated within the same transaction.
+func (b *Base) InsertMappings(msgid, bucket []byte, groups [][]byte, nums []int64, expire time.Time) (err error) {
+	tx,err := b.DB.Begin()
+	if err!=nil { return }
+	defer func() {
+		if err!=nil { tx.Rollback() ; return }
+		err = tx.Commit()
+	}()
+	_,err = tx.Exec(`INSERT INTO msgidbkt (msgid,bucket,expir) VALUES ($1,$2,$3);`,msgid,bucket,expire)
+	if err!=nil { return }
+	for i,group := range groups {
+		_,err = tx.Exec(`INSERT INTO ngrpnumvalue (ngrp,mnum,msgid,expir) VALUES ($1,$2,$3,$4);`,group,nums[i],msgid,expire)
+		if err!=nil { return }
+		_,err = tx.Exec(`UPDATE ngrpcnt SET gcount = gcount + 1 WHERE ngrp = $1;`,group)
+		if err!=nil { return }
+	}
+	return
+}
+func (b *Base) DeleteGroupMapping(group []byte, num int64, msgid []byte) (err error) {
+	tx,err := b.DB.Begin()
+	if err!=nil { return }
+	defer func() {
+		if err!=nil { tx.Rollback() ; return }
+		err = tx.Commit()
+	}()
+	res,err := tx.Exec(`DELETE FROM ngrpnumvalue WHERE ngrp=$1 AND mnum=$2 AND msgid=$3;`,group,num,msgid)
+	if err!=nil { return }
+	i,err := res.RowsAffected()
+	if err!=nil || i==0 { return }
+	_,err = tx.Exec(`UPDATE ngrpcnt SET gcount = gcount - $1 WHERE ngrp = $2;`,i,group)
+	return
+}
+func (b *Base) DeleteIDMapping(msgid []byte) error {
+	_,err := b.DB.Exec(`DELETE FROM msgidbkt WHERE msgid=$1;`,msgid)
+	return err
+}
 func (b *Base) AdmPutDescr(group []byte, descr []byte) {
 	_,err := b.DB.Exec(`INSERT INTO ngrpstatic (ngrp,descr) VALUES ($1,$2);`,group,descr)
 	if err!=nil { b.DB.Exec(`UPDATE ngrpstatic SET descr=$1 WHERE ngrp=$2;`     ,descr,group) }
@@ -28,7 +28,6 @@ import "github.com/byte-mug/fastnntp"
 import "database/sql"
 import "text/template"
 import "golang.org/x/crypto/bcrypt"
-import "bytes"
 import "github.com/maxymania/fastnntp-polyglot-labs/util/sqlutil"
 import "github.com/maxymania/fastnntp-polyglot/postauth"
 
@@ -42,51 +41,61 @@ var createTables = template.Must(template.New("create").Parse(`
 
 
 type LoginDB struct {
-	DB *sql.DB
+	DB      *sql.DB
+	Dialect *sqlutil.Dialect // nil = PostgreSQL
 }
 
+var Schema = &sqlutil.Schema{
+	Model: "sqlauth",
+	Probe: "userauth",
+	Migrations: []sqlutil.Migration{
+		{Version: 1, Name: "create tables", SQL: createTables},
+	},
+}
+
+func (l *LoginDB) SqlSchema() *sqlutil.Schema { return Schema }
+
 func (l *LoginDB) CreateSqlModel(d *sqlutil.Dialect) error {
-	buf := new(bytes.Buffer)
-	createTables.Execute(buf, d)
-	_,err := l.DB.Exec(buf.String())
+	_,err := Schema.Migrate(l.DB,d,nil)
 	return err
 }
 func (l *LoginDB) InsertUser(user, password []byte,rank postauth.AuthRank) error {
 	b,e := bcrypt.GenerateFromPassword(password,0)
 	if e!=nil { return e }
-	_,e = l.DB.Exec(`INSERT INTO userauth VALUES ($1,$2,$3)`,user,b,uint8(rank))
+	_,e = l.Dialect.Exec(l.DB,`INSERT INTO userauth VALUES ($1,$2,$3)`,user,b,uint8(rank))
 	return e
 }
 func (l *LoginDB) UpdateUserPassword(user, password []byte) error {
 	b,e := bcrypt.GenerateFromPassword(password,0)
 	if e!=nil { return e }
-	res,e := l.DB.Exec(`UPDATE userauth SET pcrypt=$1 WHERE usernm=$2`,b,user)
+	res,e := l.Dialect.Exec(l.DB,`UPDATE userauth SET pcrypt=$1 WHERE usernm=$2`,b,user)
 	if e!=nil { return e }
 	if ra,ee := res.RowsAffected() ; ee==nil && ra<1 { e = fmt.Errorf("No such user: %s",user) }
 	return e
 }
 func (l *LoginDB) UpdateUserRank(user []byte, rank postauth.AuthRank) error {
-	res,e := l.DB.Exec(`UPDATE userauth SET u_rank=$1 WHERE usernm=$2`,uint8(rank),user)
+	res,e := l.Dialect.Exec(l.DB,`UPDATE userauth SET u_rank=$1 WHERE usernm=$2`,uint8(rank),user)
 	if e!=nil { return e }
 	if ra,ee := res.RowsAffected() ; ee==nil && ra<1 { e = fmt.Errorf("No such user: %s",user) }
 	return e
 }
 
+// Reports, whether the user exists (the row has been found and scanned without error).
 func (l *LoginDB) CheckUser(user []byte) bool {
 	var i int
-	return l.DB.QueryRow(`SELECT 1 FROM userauth WHERE usernm=$1`,user).Scan(&i)!=nil && i==1
+	return l.Dialect.QueryRow(l.DB,`SELECT 1 FROM userauth WHERE usernm=$1`,user).Scan(&i)==nil && i==1
 }
 func (l *LoginDB) AuhtUser(user, password []byte, h *fastnntp.Handler) (postauth.AuthRank,bool,*fastnntp.Handler) {
-	var rb sql.RawBytes
+	var rb []byte // RawBytes is not allowed with QueryRow.
 	var rank uint8
-	if l.DB.QueryRow(`SELECT pcrypt, u_rank FROM userauth WHERE usernm=$1`,user).Scan(&rb,&rank)!=nil { return 0,false,nil }
+	if l.Dialect.QueryRow(l.DB,`SELECT pcrypt, u_rank FROM userauth WHERE usernm=$1`,user).Scan(&rb,&rank)!=nil { return 0,false,nil }
 	if bcrypt.CompareHashAndPassword(rb,password)!=nil { return 0,false,nil }
 	return postauth.AuthRank(rank),true,nil
 }
 func (l *LoginDB) AuhtUserLite(user, password []byte) (postauth.AuthRank,bool) {
-	var rb sql.RawBytes
+	var rb []byte // RawBytes is not allowed with QueryRow.
 	var rank uint8
-	if l.DB.QueryRow(`SELECT pcrypt, u_rank FROM userauth WHERE usernm=$1`,user).Scan(&rb,&rank)!=nil { return 0,false }
+	if l.Dialect.QueryRow(l.DB,`SELECT pcrypt, u_rank FROM userauth WHERE usernm=$1`,user).Scan(&rb,&rank)!=nil { return 0,false }
 	if bcrypt.CompareHashAndPassword(rb,password)!=nil { return 0,false }
 	return postauth.AuthRank(rank),true
 }
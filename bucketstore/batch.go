@@ -0,0 +1,66 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package bucketstore
+
+import "time"
+
+// An object to be stored by PutMany.
+type Item struct{
+	Id, Over, Head, Body []byte
+	Expire time.Time
+}
+
+/*
+Optional interface. Stores multiple objects at once. The result contains one error per item,
+nil, if the item has been stored.
+*/
+type BatchPutter interface{
+	PutMany(items []Item) []error
+}
+
+// Optional interface of an OverStore. See BatchPutter.
+type OverBatchPutter interface{
+	OverPutMany(bucket []byte, items []Item) []error
+}
+
+// Uses BatchPutter, if implemented by s, Put otherwise.
+func PutMany(s BucketStore, items []Item) []error {
+	if bp,ok := s.(BatchPutter) ; ok { return bp.PutMany(items) }
+	errs := make([]error,len(items))
+	for i,it := range items {
+		errs[i] = s.Put(it.Id,it.Over,it.Head,it.Body,it.Expire)
+	}
+	return errs
+}
+
+// Uses OverBatchPutter, if implemented by s, OverPut otherwise.
+func OverPutMany(s OverStore, bucket []byte, items []Item) []error {
+	if bp,ok := s.(OverBatchPutter) ; ok { return bp.OverPutMany(bucket,items) }
+	errs := make([]error,len(items))
+	for i,it := range items {
+		errs[i] = s.OverPut(bucket,it.Id,it.Over,it.Head,it.Body,it.Expire)
+	}
+	return errs
+}
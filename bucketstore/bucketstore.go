@@ -24,11 +24,14 @@ SOFTWARE.
 package bucketstore
 
 import "errors"
+import "fmt"
 import "time"
 import "github.com/maxymania/fastnntp-polyglot-labs/bufferex"
 
 var EExists = errors.New("Object exists")
 var ENoBucket = errors.New("No such bucket")
+var EReadOnly = errors.New("Bucket is read-only")
+var ECollision = errors.New("Bucket UUID collision")
 
 // Mainly used for Network Remoting:
 
@@ -40,6 +43,11 @@ var EBadRequest = errors.New("Bad Request")
 
 var ETemporaryFailure = errors.New("Temporary Failure")
 
+// Optional features
+
+var ENotSupported = errors.New("Not supported")
+var ERange = errors.New("Range not satisfiable")
+
 type BucketStore interface{
 	Put(id, overv, head, body []byte, expire time.Time) error
 	Get(id []byte, overv, head, body *bufferex.Binary) (ok bool,e error)
@@ -47,6 +55,30 @@ type BucketStore interface{
 	FreeStorage() (int64,error)
 }
 
+/*
+Optional interface. Enumerates the objects of a bucket in a stable order, starting after
+the object 'after' (or at the beginning, if 'after' is empty), until targ returns false.
+*/
+type Lister interface{
+	List(after []byte, targ func(id []byte, expire time.Time) bool) error
+}
+
+/*
+Optional interface. Like Lister, but also yields the time, the object has been stored at.
+The stored time is zero, if it is unknown (eg. objects written by an older version).
+*/
+type AgeLister interface{
+	ListAge(after []byte, targ func(id []byte, stored, expire time.Time) bool) error
+}
+
+/*
+Optional interface. Removes a single object from the bucket. Deleting an object, that
+doesn't exist, is not an error. The space might not be reclaimed before the object expires.
+*/
+type Deleter interface{
+	Delete(id []byte) error
+}
+
 type OverStore interface{
 	Submit(id, overv, head, body []byte, expire time.Time) (bucket bufferex.Binary,err error)
 	OverPut(bucket []byte, id, overv, head, body []byte, expire time.Time) error
@@ -55,12 +87,62 @@ type OverStore interface{
 	OverFreeStorage(bucket []byte) (int64,error)
 }
 
+// Optional interface of an OverStore. See Deleter.
+type OverDeleter interface{
+	OverDelete(bucket []byte, id []byte) error
+}
+
+/*
+The mode of a bucket. Non-writable buckets still serve reads and expiry,
+but refuse new articles.
+*/
+type Mode uint8
+const (
+	ModeWritable Mode = iota
+	ModeReadOnly
+	ModeDraining
+)
+func (m Mode) Writable() bool { return m==ModeWritable }
+func (m Mode) String() string {
+	switch m {
+	case ModeWritable: return "writable"
+	case ModeReadOnly: return "read-only"
+	case ModeDraining: return "draining"
+	}
+	return fmt.Sprintf("mode(%d)",uint8(m))
+}
+func ParseMode(s string) (Mode,error) {
+	switch s {
+	case "","writable": return ModeWritable,nil
+	case "read-only","readonly": return ModeReadOnly,nil
+	case "draining": return ModeDraining,nil
+	}
+	return 0,fmt.Errorf("Invalid bucket mode %q",s)
+}
+
+// The label in "guid.cfg" holding the storage class of a bucket (eg. "ssd", "hdd" or "archive").
+const ClassLabel = "class"
+
+/*
+Optional interface of an OverStore: restricts placement to buckets of a storage class.
+An empty class means any bucket.
+*/
+type ClassSubmitter interface{
+	SubmitClass(class string, id, overv, head, body []byte, expire time.Time) (bucket bufferex.Binary,err error)
+}
+
 type Config struct{
 	MaxSpace int64 // Max. Storage consuption in bytes.
 	MaxFiles int // Max. number of file descriptors
+	
+	Resize   bool // Allow MaxSpace to differ from the capacity recorded in "guid.cfg".
+	Labels   map[string]string // If not nil, replaces the labels recorded in "guid.cfg".
 }
 
 type Loader func(path string, cfg *Config) (BucketStore,error)
 
 var Backends = make(map[string]Loader)
 
+// On-disk format versions of the backends. OpenStore refuses buckets with a newer format.
+var Formats = make(map[string]int)
+
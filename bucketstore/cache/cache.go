@@ -0,0 +1,251 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+/*
+A read-through cache for an OverStore.
+
+The cache keeps size-bounded LRU lists of the (still compressed) overview, head and body
+blobs, keyed by bucket and ID, and remembers misses for a limited time.
+*/
+package cache
+
+import "container/list"
+import "strings"
+import "sync"
+import "time"
+import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore"
+import "github.com/maxymania/fastnntp-polyglot-labs/bufferex"
+
+const (
+	FieldOver = iota
+	FieldHead
+	FieldBody
+	NumFields
+)
+
+type Config struct{
+	MaxOver, MaxHead, MaxBody int64 // Max. size of the cached blobs in bytes, per field. 0 = don't cache.
+	
+	NegativeTTL time.Duration // How long misses are remembered. 0 = don't remember misses.
+	MaxNegative int           // Max. number of remembered misses. Default: 10000
+}
+
+type Stats struct{
+	Hits, Misses, Evictions, Bytes [NumFields]int64
+	NegativeHits int64
+}
+// Returns the hit rate of the given field.
+func (s *Stats) HitRate(field int) float64 {
+	n := s.Hits[field]+s.Misses[field]
+	if n==0 { return 0 }
+	return float64(s.Hits[field])/float64(n)
+}
+
+type entry struct{
+	key   string
+	data  []byte
+	until time.Time
+	size  int64
+}
+
+type lru struct{
+	max, size int64
+	ll *list.List
+	m  map[string]*list.Element
+}
+func newLru(max int64) *lru {
+	return &lru{max:max,ll:list.New(),m:make(map[string]*list.Element)}
+}
+func (l *lru) get(key string) *entry {
+	el := l.m[key]
+	if el==nil { return nil }
+	l.ll.MoveToFront(el)
+	return el.Value.(*entry)
+}
+func (l *lru) del(el *list.Element) {
+	e := l.ll.Remove(el).(*entry)
+	delete(l.m,e.key)
+	l.size -= e.size
+}
+func (l *lru) remove(key string) {
+	if el := l.m[key] ; el!=nil { l.del(el) }
+}
+func (l *lru) removePrefix(prefix string) {
+	for el := l.ll.Front() ; el!=nil ; {
+		next := el.Next()
+		if strings.HasPrefix(el.Value.(*entry).key,prefix) { l.del(el) }
+		el = next
+	}
+}
+// Returns the number of evicted entries.
+func (l *lru) add(e *entry) (n int64) {
+	if l.max<=0 || e.size>l.max { return }
+	l.remove(e.key)
+	l.m[e.key] = l.ll.PushFront(e)
+	l.size += e.size
+	for l.size>l.max {
+		l.del(l.ll.Back())
+		n++
+	}
+	return
+}
+
+/*
+Wraps an OverStore. OverPut and Submit clear remembered misses, OverDelete and OverExpire
+invalidate the cached blobs of the object or bucket. The optional interfaces of the bucketstore
+package are passed through.
+*/
+type OverStoreCache struct{
+	bucketstore.OverStore
+	
+	mutex sync.Mutex
+	blobs [NumFields]*lru
+	neg   *lru
+	ttl   time.Duration
+	stats Stats
+}
+func New(s bucketstore.OverStore, cfg *Config) *OverStoreCache {
+	maxneg := int64(cfg.MaxNegative)
+	if maxneg<=0 { maxneg = 10000 }
+	c := &OverStoreCache{OverStore:s,neg:newLru(maxneg),ttl:cfg.NegativeTTL}
+	c.blobs[FieldOver] = newLru(cfg.MaxOver)
+	c.blobs[FieldHead] = newLru(cfg.MaxHead)
+	c.blobs[FieldBody] = newLru(cfg.MaxBody)
+	return c
+}
+
+func key(bucket, id []byte) string {
+	return string(bucket)+"/"+string(id)
+}
+
+func (c *OverStoreCache) Stats() Stats {
+	c.mutex.Lock(); defer c.mutex.Unlock()
+	s := c.stats
+	for i,l := range c.blobs { s.Bytes[i] = l.size }
+	return s
+}
+
+func (c *OverStoreCache) OverGet(bucket []byte, id []byte, overv, head, body *bufferex.Binary) (ok bool,e error) {
+	k := key(bucket,id)
+	ptrs := [NumFields]*bufferex.Binary{overv,head,body}
+	var hits [NumFields][]byte
+	
+	/*
+	Served from the cache, only if every requested field is cached. Existence checks (no field
+	requested) go to the store, or are answered by a remembered miss.
+	*/
+	all := false
+	missed := false
+	
+	c.mutex.Lock()
+	if c.ttl>0 {
+		if ne := c.neg.get(k) ; ne!=nil {
+			if time.Now().Before(ne.until) {
+				c.stats.NegativeHits++
+				c.mutex.Unlock()
+				return false,nil
+			}
+			c.neg.remove(k)
+		}
+	}
+	for i,p := range ptrs {
+		if p==nil { continue }
+		if ent := c.blobs[i].get(k) ; ent!=nil {
+			hits[i] = ent.data
+			c.stats.Hits[i]++
+			all = true
+		} else {
+			missed = true
+			c.stats.Misses[i]++
+		}
+	}
+	c.mutex.Unlock()
+	if missed { all = false }
+	
+	if all {
+		for i,p := range ptrs {
+			if p!=nil { *p = bufferex.NewBinary(hits[i]) }
+		}
+		return true,nil
+	}
+	
+	ok,e = c.OverStore.OverGet(bucket,id,overv,head,body)
+	if e!=nil { return }
+	
+	c.mutex.Lock(); defer c.mutex.Unlock()
+	if !ok {
+		if c.ttl>0 { c.neg.add(&entry{key:k,until:time.Now().Add(c.ttl),size:1}) }
+		return
+	}
+	for i,p := range ptrs {
+		if p==nil || hits[i]!=nil { continue }
+		data := append([]byte(nil),p.Bytes()...)
+		c.stats.Evictions[i] += c.blobs[i].add(&entry{key:k,data:data,size:int64(len(data))})
+	}
+	return
+}
+func (c *OverStoreCache) OverPut(bucket []byte, id, overv, head, body []byte, expire time.Time) error {
+	err := c.OverStore.OverPut(bucket,id,overv,head,body,expire)
+	if err==nil { c.forget(key(bucket,id)) }
+	return err
+}
+func (c *OverStoreCache) Submit(id, overv, head, body []byte, expire time.Time) (bucket bufferex.Binary,err error) {
+	bucket,err = c.OverStore.Submit(id,overv,head,body,expire)
+	if len(bucket.Bytes())>0 { c.forget(key(bucket.Bytes(),id)) }
+	return
+}
+func (c *OverStoreCache) SubmitClass(class string, id, overv, head, body []byte, expire time.Time) (bucket bufferex.Binary,err error) {
+	if cs,ok := c.OverStore.(bucketstore.ClassSubmitter) ; ok {
+		bucket,err = cs.SubmitClass(class,id,overv,head,body,expire)
+	} else {
+		bucket,err = c.OverStore.Submit(id,overv,head,body,expire)
+	}
+	if len(bucket.Bytes())>0 { c.forget(key(bucket.Bytes(),id)) }
+	return
+}
+func (c *OverStoreCache) forget(k string) {
+	c.mutex.Lock(); defer c.mutex.Unlock()
+	c.neg.remove(k)
+}
+
+// Implements bucketstore.OverDeleter, if the underlying OverStore does.
+func (c *OverStoreCache) OverDelete(bucket []byte, id []byte) error {
+	d,ok := c.OverStore.(bucketstore.OverDeleter)
+	if !ok { return bucketstore.ENotSupported }
+	err := d.OverDelete(bucket,id)
+	k := key(bucket,id)
+	c.mutex.Lock()
+	for _,l := range c.blobs { l.remove(k) }
+	c.mutex.Unlock()
+	return err
+}
+
+// The cache doesn't know the expiry of its entries, so the whole bucket is invalidated.
+func (c *OverStoreCache) OverExpire(bucket []byte, expire time.Time) error {
+	err := c.OverStore.OverExpire(bucket,expire)
+	prefix := string(bucket)+"/"
+	c.mutex.Lock()
+	for _,l := range c.blobs { l.removePrefix(prefix) }
+	c.neg.removePrefix(prefix)
+	c.mutex.Unlock()
+	return err
+}
@@ -0,0 +1,93 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+
+package cache
+
+import "bytes"
+import "io"
+import "io/ioutil"
+import "time"
+import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore"
+import "github.com/maxymania/fastnntp-polyglot-labs/bufferex"
+
+/*
+Pass-throughs of the optional interfaces. The wrapped store is asked through the helpers of
+the bucketstore package, so the fallbacks are the same as without the cache. Bodies are served
+from the cache, if cached, but streamed bodies are not added to it.
+*/
+
+// Returns the cached body, or nil. The data must not be modified.
+func (c *OverStoreCache) cachedBody(k string) []byte {
+	c.mutex.Lock(); defer c.mutex.Unlock()
+	ent := c.blobs[FieldBody].get(k)
+	if ent==nil { return nil }
+	c.stats.Hits[FieldBody]++
+	return ent.data
+}
+
+func (c *OverStoreCache) OverGetReader(bucket []byte, id []byte, overv, head *bufferex.Binary) (body io.ReadCloser, size int64, ok bool, e error) {
+	data := c.cachedBody(key(bucket,id))
+	if data==nil { return bucketstore.OverGetReader(c.OverStore,bucket,id,overv,head) }
+	if overv!=nil || head!=nil {
+		ok,e = c.OverGet(bucket,id,overv,head,nil)
+		if e!=nil || !ok { return }
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)),int64(len(data)),true,nil
+}
+func (c *OverStoreCache) OverGetRange(bucket []byte, id []byte, off, length int64) (body io.ReadCloser, size int64, ok bool, e error) {
+	data := c.cachedBody(key(bucket,id))
+	if data==nil { return bucketstore.OverGetRange(c.OverStore,bucket,id,off,length) }
+	size = int64(len(data))
+	off,length,e = bucketstore.ClipRange(off,length,size)
+	if e!=nil { return nil,0,false,e }
+	return ioutil.NopCloser(bytes.NewReader(data[off:off+length])),size,true,nil
+}
+func (c *OverStoreCache) OverPutReader(bucket []byte, id, overv, head []byte, body io.Reader, size int64, expire time.Time) error {
+	err := bucketstore.OverPutReader(c.OverStore,bucket,id,overv,head,body,size,expire)
+	if err==nil { c.forget(key(bucket,id)) }
+	return err
+}
+func (c *OverStoreCache) OverPutMany(bucket []byte, items []bucketstore.Item) []error {
+	errs := bucketstore.OverPutMany(c.OverStore,bucket,items)
+	for i,err := range errs {
+		if err==nil { c.forget(key(bucket,items[i].Id)) }
+	}
+	return errs
+}
+func (c *OverStoreCache) OverScan(bucket []byte, token []byte, filter bucketstore.ScanFilter, limit int) (entries []bucketstore.ScanEntry, next []byte, e error) {
+	return bucketstore.OverScan(c.OverStore,bucket,token,filter,limit)
+}
+
+// If the store doesn't implement bucketstore.OverStater, the object is read through the cache.
+func (c *OverStoreCache) OverStat(bucket []byte, id []byte) (st bucketstore.ObjectStat, ok bool, e error) {
+	if sr,isSr := c.OverStore.(bucketstore.OverStater) ; isSr { return sr.OverStat(bucket,id) }
+	var over,head,body bufferex.Binary
+	ok,e = c.OverGet(bucket,id,&over,&head,&body)
+	st.Over,st.Head,st.Body = len(over.Bytes()),len(head.Bytes()),len(body.Bytes())
+	over.Free()
+	head.Free()
+	body.Free()
+	return
+}
@@ -28,7 +28,10 @@ import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore/remote"
 import "github.com/hashicorp/memberlist"
 import "github.com/vmihailenco/msgpack"
 import "net"
+import "fmt"
+import "sort"
 import "sync"
+import "time"
 import "github.com/valyala/fasthttp"
 
 const (
@@ -42,6 +45,23 @@ func (a NodeError) Error() string { return "Node Error!" }
 
 var ENodeError error = NodeError(0)
 
+/*
+A bucket, that has been refused, because its UUID is already served by an other bucket.
+This usually happens if a disk image has been cloned.
+*/
+type CollisionError struct{
+	Uuid  string
+	Node  string // The node advertising the refused bucket, "" if local.
+	Owner string // The node serving the UUID, "" if local.
+}
+func (c *CollisionError) Error() string {
+	return fmt.Sprintf("Bucket %s of %s collides with bucket of %s",c.Uuid,nodeName(c.Node),nodeName(c.Owner))
+}
+func nodeName(n string) string {
+	if n=="" { return "local node" }
+	return "node "+n
+}
+
 type KCPOptions struct{
 	_msgpack struct{} `msgpack:",asArray"`
 	DataShards   int
@@ -52,6 +72,8 @@ type KCPOptions struct{
 
 type MetaData struct{
 	Buckets []string
+	Modes   map[string]bucketstore.Mode // Non-writable buckets.
+	Classes map[string]string // Storage classes of the buckets, if any.
 	Proto   uint
 	Port    uint
 	KCP     KCPOptions
@@ -84,32 +106,240 @@ type Membered struct{
 	
 	Ml     sync.Mutex
 	Member MemberMap
+	
+	buckets map[string]*bucketstore.Bucket
+	collide map[string]*CollisionError
+	metaErr error
+	
+	labels  map[string]map[string]string            // Labels of the local buckets.
+	remote  map[string]map[string]map[string]string // Labels of the remote buckets, by node.
+	
+	/*
+	Optional. If set, changes to Meta are gossiped using List.UpdateNode(), and the
+	bucket labels are exchanged with the other nodes (see LocalState).
+	*/
+	List   *memberlist.Memberlist
 }
 func NewMembered() *Membered{
-	return &Membered{
+	m := &Membered{
 		Router:remote.NewBucketRouter(),
 		Member:make(MemberMap),
+		buckets:make(map[string]*bucketstore.Bucket),
+		collide:make(map[string]*CollisionError),
+		labels:make(map[string]map[string]string),
+		remote:make(map[string]map[string]map[string]string),
 	}
+	m.Router.Cluster = m
+	return m
 }
 func (m *Membered) ListenAndServe() {
 	las := ServerPlugins[m.Meta.Proto]
 	if las!=nil { las(&m.Meta,m.Router.Handler) }
 }
-func (m *Membered) AddLocal(bu *bucketstore.Bucket) {
+func (m *Membered) AddLocal(bu *bucketstore.Bucket) error {
+	err := m.Router.AddLocal(bu)
+	m.Ml.Lock(); defer m.Ml.Unlock()
+	if err!=nil {
+		m.collision(bu.Uuid,"")
+		return err
+	}
 	m.Meta.Buckets = append(m.Meta.Buckets,bu.Uuid)
-	m.Router.AddLocal(bu)
+	m.setMode(bu.Uuid,bu.Mode)
+	if bu.Ident!=nil && len(bu.Ident.Labels)!=0 {
+		m.labels[bu.Uuid] = bu.Ident.Labels
+		if cl := bu.Ident.Labels[bucketstore.ClassLabel] ; cl!="" {
+			if m.Meta.Classes==nil { m.Meta.Classes = make(map[string]string) }
+			m.Meta.Classes[bu.Uuid] = cl
+		}
+	}
+	m.buckets[bu.Uuid] = bu
+	return nil
+}
+
+/*
+Returns the labels of a bucket (local or remote). The labels of remote buckets are not part of
+the node metadata, which is limited in size, but of the state exchanged by LocalState.
+*/
+func (m *Membered) Labels(uuid string) map[string]string {
+	m.Ml.Lock(); defer m.Ml.Unlock()
+	if _,ok := m.buckets[uuid] ; ok { return m.labels[uuid] }
+	owner,ok := m.owner(uuid,"")
+	if !ok { return nil }
+	return m.remote[owner][uuid]
+}
+
+// m.Ml must be held.
+func (m *Membered) owner(uuid, node string) (string,bool) {
+	if _,ok := m.buckets[uuid] ; ok { return "",true }
+	for name,member := range m.Member {
+		if name==node { continue }
+		for _,sn := range member.Meta.Buckets {
+			if sn==uuid { return name,true }
+		}
+	}
+	return "",false
+}
+// m.Ml must be held.
+func (m *Membered) collision(uuid, node string) {
+	owner,_ := m.owner(uuid,node)
+	m.collide[node+"/"+uuid] = &CollisionError{uuid,node,owner}
+}
+
+// Implements remote.ClusterInfo.
+func (m *Membered) BucketOwner(uuid string) string {
+	m.Ml.Lock(); defer m.Ml.Unlock()
+	owner,_ := m.owner(uuid,"")
+	return owner
+}
+
+type MemberView struct{
+	Name    string   `json:"name"`
+	Proto   uint     `json:"proto"`
+	Port    uint     `json:"port"`
+	Buckets []string `json:"buckets"`
+	Modes   map[string]string `json:"modes,omitempty"`
+}
+type AdminView struct{
+	Local   MemberView   `json:"local"`
+	Members []MemberView `json:"members"`
+	Health  []string     `json:"health,omitempty"`
+}
+func memberView(name string, md *MetaData) MemberView {
+	mv := MemberView{Name:name,Proto:md.Proto,Port:md.Port,Buckets:append([]string(nil),md.Buckets...)}
+	if len(md.Modes)!=0 {
+		mv.Modes = make(map[string]string,len(md.Modes))
+		for sn,mode := range md.Modes { mv.Modes[sn] = mode.String() }
+	}
+	return mv
+}
+
+// Implements remote.ClusterInfo.
+func (m *Membered) AdminView() interface{} {
+	av := new(AdminView)
+	for _,err := range m.Health() { av.Health = append(av.Health,err.Error()) }
+	m.Ml.Lock(); defer m.Ml.Unlock()
+	av.Local = memberView("",&m.Meta)
+	for name,member := range m.Member { av.Members = append(av.Members,memberView(name,&member.Meta)) }
+	sort.Slice(av.Members,func(i,j int) bool { return av.Members[i].Name<av.Members[j].Name })
+	return av
+}
+
+// Returns the health errors of this node, such as bucket UUID collisions.
+func (m *Membered) Health() (errs []error) {
+	m.Ml.Lock(); defer m.Ml.Unlock()
+	keys := make([]string,0,len(m.collide))
+	for k := range m.collide { keys = append(keys,k) }
+	sort.Strings(keys)
+	for _,k := range keys { errs = append(errs,m.collide[k]) }
+	if m.metaErr!=nil { errs = append(errs,m.metaErr) }
+	return
+}
+func removeString(set []string, s string) []string {
+	i := 0
+	for _,e := range set {
+		if e==s { continue }
+		set[i] = e
+		i++
+	}
+	return set[:i]
+}
+func (m *Membered) update() {
+	if m.List!=nil { m.List.UpdateNode(time.Second*10) }
+}
+
+func (m *Membered) setMode(uuid string, mode bucketstore.Mode) {
+	if mode.Writable() {
+		delete(m.Meta.Modes,uuid)
+		return
+	}
+	if m.Meta.Modes==nil { m.Meta.Modes = make(map[string]bucketstore.Mode) }
+	m.Meta.Modes[uuid] = mode
+}
+
+// Changes the mode of a local bucket, persists it and advertises it to the cluster.
+func (m *Membered) SetMode(uuid string, mode bucketstore.Mode) error {
+	m.Ml.Lock()
+	bu := m.buckets[uuid]
+	if bu==nil { m.Ml.Unlock() ; return bucketstore.ENoBucket }
+	err := bu.SetMode(mode)
+	if err==nil { m.setMode(uuid,mode) }
+	m.Ml.Unlock()
+	if err!=nil { return err }
+	m.Router.SetMode(uuid,mode)
+	m.update()
+	return nil
+}
+
+// Withdraws a (drained) local bucket from the cluster.
+func (m *Membered) Retire(uuid string) {
+	m.Ml.Lock()
+	m.Meta.Buckets = removeString(m.Meta.Buckets,uuid)
+	delete(m.Meta.Modes,uuid)
+	delete(m.Meta.Classes,uuid)
+	delete(m.labels,uuid)
+	delete(m.buckets,uuid)
+	m.Ml.Unlock()
+	m.Router.RemoveLocal(uuid)
+	m.update()
 }
+/*
+If the metadata exceeds limit, the storage classes are left out (the other nodes still learn them
+from the labels, see LocalState). If it still doesn't fit, no metadata is published. Both cases
+are reported by Health.
+*/
 func (m *Membered) NodeMeta(limit int) []byte {
+	m.Ml.Lock(); defer m.Ml.Unlock()
+	m.metaErr = nil
 	b,_ := msgpack.Marshal(&m.Meta)
-	if len(b)>limit { return nil }
-	return b
+	if len(b)<=limit { return b }
+	md := m.Meta
+	md.Classes = nil
+	b,_ = msgpack.Marshal(&md)
+	if len(b)<=limit {
+		m.metaErr = fmt.Errorf("Node metadata exceeds %d bytes, storage classes are left out",limit)
+		return b
+	}
+	m.metaErr = fmt.Errorf("Node metadata exceeds %d bytes, the local buckets are not advertised",limit)
+	return nil
 }
 func (m *Membered) NotifyMsg([]byte){}
 func (m *Membered) GetBroadcasts(overhead, limit int) [][]byte { return nil }
-func (m *Membered) LocalState(join bool) []byte { return nil }
-func (m *Membered) MergeRemoteState(buf []byte, join bool) {}
+
+// The state exchanged by LocalState and MergeRemoteState. Unlike the node metadata, it has no size limit.
+type nodeState struct{
+	Node   string
+	Labels map[string]map[string]string
+}
+
+// Sends the labels of the local buckets.
+func (m *Membered) LocalState(join bool) []byte {
+	if m.List==nil { return nil }
+	st := nodeState{Node:m.List.LocalNode().Name}
+	m.Ml.Lock(); defer m.Ml.Unlock()
+	st.Labels = m.labels
+	b,_ := msgpack.Marshal(&st)
+	return b
+}
+func (m *Membered) MergeRemoteState(buf []byte, join bool) {
+	var st nodeState
+	if msgpack.Unmarshal(buf,&st)!=nil || st.Node=="" { return }
+	m.Ml.Lock(); defer m.Ml.Unlock()
+	m.remote[st.Node] = st.Labels
+	if member := m.Member[st.Node] ; member!=nil { m.setClasses(member,st.Node) }
+}
+
+// Applies the storage classes of the buckets of a member. m.Ml must be held.
+func (m *Membered) setClasses(member *OtherMember, node string) {
+	labels := m.remote[node]
+	for _,sn := range member.Meta.Buckets {
+		cl := member.Meta.Classes[sn]
+		if cl=="" { cl = labels[sn][bucketstore.ClassLabel] }
+		if cl!="" { m.Router.SetClass(sn,cl) }
+	}
+}
+
 func (m *Membered) NotifyUpdate(n *memberlist.Node) {
-	m.NotifyLeave(n)
+	m.leave(n)
 	m.NotifyJoin(n)
 }
 func (m *Membered) NotifyJoin(n *memberlist.Node) {
@@ -123,25 +353,54 @@ func (m *Membered) NotifyJoin(n *memberlist.Node) {
 	member.Client = ldr(&member.Meta,n.Addr)
 	if member.Client==nil { return }
 	m.Member[n.Name] = member
-	m.Router.AddNode2(member.Meta.Buckets,member.Client)
+	refused := m.Router.AddNode2(member.Meta.Buckets,member.Client)
+	for _,sn := range refused {
+		m.collision(sn,n.Name)
+		member.Meta.Buckets = removeString(member.Meta.Buckets,sn)
+		delete(member.Meta.Modes,sn)
+		delete(member.Meta.Classes,sn)
+	}
+	for sn,mode := range member.Meta.Modes { m.Router.SetMode(sn,mode) }
+	m.setClasses(member,n.Name)
 }
 func (m *Membered) NotifyLeave(n *memberlist.Node) {
+	m.leave(n)
+	m.Ml.Lock(); defer m.Ml.Unlock()
+	delete(m.remote,n.Name)
+}
+func (m *Membered) leave(n *memberlist.Node) {
 	m.Ml.Lock(); defer m.Ml.Unlock()
 	member := m.Member[n.Name]
 	if member==nil { return }
 	delete(m.Member,n.Name)
+	for k,c := range m.collide {
+		if c.Node==n.Name { delete(m.collide,k) }
+	}
 	m.Router.Remove2(member.Meta.Buckets)
 	type lDestroy interface{ Destroy() }
 	if ld,ok := member.Client.(lDestroy) ; ok { ld.Destroy() }
 }
 func (m *Membered) NotifyMerge(peers []*memberlist.Node) error {
-	md := &MetaData{}
+	seen := make(map[string]string)
+	m.Ml.Lock(); defer m.Ml.Unlock()
 	for _,peer := range peers {
+		if len(peer.Meta)==0 { continue } // No buckets advertised (see NodeMeta).
+		md := &MetaData{}
 		if msgpack.Unmarshal(peer.Meta,md)!=nil { return ENodeError }
+		for _,sn := range md.Buckets {
+			if other,ok := seen[sn] ; ok {
+				m.collide[peer.Name+"/"+sn] = &CollisionError{sn,peer.Name,other}
+			} else if owner,ok := m.owner(sn,peer.Name) ; ok {
+				m.collide[peer.Name+"/"+sn] = &CollisionError{sn,peer.Name,owner}
+			} else {
+				seen[sn] = peer.Name
+			}
+		}
 	}
 	return nil
 }
 func (m *Membered) NotifyAlive(peer *memberlist.Node) error {
+	if len(peer.Meta)==0 { return nil }
 	if msgpack.Unmarshal(peer.Meta,&MetaData{})!=nil { return ENodeError }
 	return nil
 }
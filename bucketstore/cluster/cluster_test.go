@@ -0,0 +1,61 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+
+package cluster
+
+import "fmt"
+import "testing"
+import "github.com/hashicorp/memberlist"
+import "github.com/vmihailenco/msgpack"
+
+func TestNodeMetaLimit(t *testing.T) {
+	m := NewMembered()
+	m.Meta.Classes = make(map[string]string)
+	for i := 0 ; i<8 ; i++ {
+		sn := fmt.Sprintf("%08d-0000-0000-0000-000000000000",i)
+		m.Meta.Buckets = append(m.Meta.Buckets,sn)
+		m.Meta.Classes[sn] = "cold-archive-tier"
+	}
+	full,_ := msgpack.Marshal(&m.Meta)
+	
+	if b := m.NodeMeta(len(full)) ; len(b)!=len(full) { t.Fatalf("NodeMeta within the limit: %d bytes, want %d",len(b),len(full)) }
+	if len(m.Health())!=0 { t.Fatalf("unexpected health errors: %v",m.Health()) }
+	
+	/* Above the limit, the classes are left out, but the buckets are still advertised. */
+	b := m.NodeMeta(len(full)-1)
+	var md MetaData
+	if msgpack.Unmarshal(b,&md)!=nil { t.Fatal("NodeMeta above the limit published no metadata") }
+	if len(md.Buckets)!=8 || len(md.Classes)!=0 { t.Fatalf("got %d buckets, %d classes, want 8, 0",len(md.Buckets),len(md.Classes)) }
+	if len(m.Health())!=1 { t.Fatal("oversized metadata not reported") }
+	
+	if b := m.NodeMeta(16) ; b!=nil { t.Fatalf("NodeMeta(16) = %d bytes",len(b)) }
+	if len(m.Health())!=1 { t.Fatal("oversized metadata not reported") }
+}
+
+func TestMergeEmptyMeta(t *testing.T) {
+	m := NewMembered()
+	if err := m.NotifyMerge([]*memberlist.Node{{Name:"empty"}}) ; err!=nil { t.Fatal(err) }
+	if err := m.NotifyAlive(&memberlist.Node{Name:"empty"}) ; err!=nil { t.Fatal(err) }
+}
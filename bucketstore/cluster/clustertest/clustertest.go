@@ -0,0 +1,298 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+/*
+An in-process multi-node cluster simulation harness.
+
+It starts a number of cluster.Membered nodes on the loopback interface, each
+serving its own buckets over one of the transports (Proto_HTTP, Proto_OO or
+Proto_KCP). Membership is simulated by feeding the nodes' metadata into each
+other's NotifyJoin/NotifyLeave hooks, so no gossip traffic is involved.
+
+Nodes can be killed (gracefully leaving), crashed (vanishing without leaving)
+and restarted, and every node has a Faults object to inject latency or packet
+loss into its server side.
+*/
+package clustertest
+
+import "fmt"
+import "io/ioutil"
+import "net"
+import "os"
+import "sync"
+
+import "github.com/hashicorp/memberlist"
+import "github.com/valyala/fasthttp"
+import "github.com/valyala/fastrpc"
+import "github.com/xtaci/kcp-go"
+
+import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore"
+import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore/cluster"
+import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore/degrader"
+import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore/remote"
+import "github.com/maxymania/fastnntp-polyglot-labs/kcphttp"
+import "github.com/maxymania/fastnntp-polyglot-labs/oohttp"
+
+import _ "github.com/maxymania/fastnntp-polyglot-labs/bucketstore/dayfile"
+
+var loopback = net.IPv4(127,0,0,1)
+
+type Config struct{
+	Nodes          int    // Number of nodes.
+	BucketsPerNode int    // Number of buckets per node. Default: 1
+	BucketSpace    int64  // Storage space of every bucket. Default: 64 MiB
+	Proto          uint   // Transport. One of cluster.Proto_*
+	KCP            cluster.KCPOptions
+	
+	// If true, the buckets are created in temporary directories, using the backend Kind.
+	// Otherwise, in-memory buckets (MemStore) are used.
+	OnDisk bool
+	Kind   string // Default: "dayfile"
+	
+	Dmd *degrader.DegraderMetadata
+}
+
+type Node struct{
+	Name     string
+	Buckets  []*bucketstore.Bucket
+	Faults   Faults
+	
+	mutex    sync.Mutex
+	membered *cluster.Membered
+	port     int
+	alive    bool
+	closer   func()
+	dirs     []string
+}
+
+// Returns the current incarnation of the node's Membered object. It is replaced on Restart().
+func (n *Node) Membered() *cluster.Membered {
+	n.mutex.Lock(); defer n.mutex.Unlock()
+	return n.membered
+}
+func (n *Node) Alive() bool {
+	n.mutex.Lock(); defer n.mutex.Unlock()
+	return n.alive
+}
+func (n *Node) Addr() string {
+	return (&net.TCPAddr{IP:loopback,Port:n.port}).String()
+}
+
+type Cluster struct{
+	cfg   Config
+	mutex sync.Mutex
+	nodes []*Node
+}
+
+func New(cfg *Config) (c *Cluster,err error) {
+	c = &Cluster{cfg:*cfg}
+	if c.cfg.BucketsPerNode<=0 { c.cfg.BucketsPerNode = 1 }
+	if c.cfg.BucketSpace<=0 { c.cfg.BucketSpace = 64<<20 }
+	if c.cfg.Kind=="" { c.cfg.Kind = "dayfile" }
+	if _,ok := cluster.ServerPlugins[c.cfg.Proto] ; !ok { return nil,fmt.Errorf("No such protocol %d",c.cfg.Proto) }
+	
+	defer func(){
+		if err!=nil { c.Close() ; c = nil }
+	}()
+	for i := 0 ; i<c.cfg.Nodes ; i++ {
+		n := &Node{Name:fmt.Sprintf("node%d",i)}
+		c.nodes = append(c.nodes,n)
+		err = c.createBuckets(n)
+		if err!=nil { return }
+		err = c.start(n)
+		if err!=nil { return }
+	}
+	for _,n := range c.nodes { c.announce(n) }
+	return
+}
+
+func (c *Cluster) createBuckets(n *Node) error {
+	for i := 0 ; i<c.cfg.BucketsPerNode ; i++ {
+		if !c.cfg.OnDisk {
+			bu := &bucketstore.Bucket{Store:NewMemStore(c.cfg.BucketSpace),Uuid:fmt.Sprintf("%s-bucket%d",n.Name,i)}
+			n.Buckets = append(n.Buckets,bu)
+			continue
+		}
+		dir,err := ioutil.TempDir("","clustertest")
+		if err!=nil { return err }
+		n.dirs = append(n.dirs,dir)
+		bu,err := bucketstore.OpenStore(c.cfg.Kind,dir,&bucketstore.Config{MaxSpace:c.cfg.BucketSpace,MaxFiles:16})
+		if err!=nil { return err }
+		n.Buckets = append(n.Buckets,bu)
+	}
+	return nil
+}
+
+func (c *Cluster) start(n *Node) error {
+	m := cluster.NewMembered()
+	m.Router.Dmd = c.cfg.Dmd
+	m.Meta.Proto = c.cfg.Proto
+	m.Meta.KCP = c.cfg.KCP
+	for _,bu := range n.Buckets {
+		if err := m.AddLocal(bu) ; err!=nil { return err }
+	}
+	
+	port,closer,err := serve(&m.Meta,n.port,&n.Faults,m.Router.Handler)
+	if err!=nil { return err }
+	m.Meta.Port = uint(port)
+	
+	n.mutex.Lock(); defer n.mutex.Unlock()
+	n.membered = m
+	n.port = port
+	n.closer = closer
+	n.alive = true
+	return nil
+}
+
+func serve(md *cluster.MetaData,port int,f *Faults,h fasthttp.RequestHandler) (int,func(),error) {
+	addr := (&net.TCPAddr{IP:loopback,Port:port}).String()
+	if md.Proto==cluster.Proto_KCP {
+		var cipher kcp.BlockCrypt
+		if len(md.KCP.Salsa20Key)>0 {
+			cipher,_ = kcp.NewSalsa20BlockCrypt(md.KCP.Salsa20Key)
+		}
+		pc,err := net.ListenPacket("udp",addr)
+		if err!=nil { return 0,nil,err }
+		l,err := kcp.ServeConn(cipher, md.KCP.DataShards, md.KCP.ParityShards, &faultPacketConn{pc,f})
+		if err!=nil { pc.Close() ; return 0,nil,err }
+		srv := kcphttp.NewServer(h)
+		tm := md.KCP.TurboMode
+		go func(){
+			for {
+				c,e := l.AcceptKCP()
+				if e!=nil { return }
+				if tm { c.SetNoDelay(1,40,1,1) }
+				go srv.Handle(c)
+			}
+		}()
+		return pc.LocalAddr().(*net.UDPAddr).Port,func(){ l.Close() ; pc.Close() },nil
+	}
+	tl,err := net.Listen("tcp",addr)
+	if err!=nil { return 0,nil,err }
+	l := newFaultListener(tl,f)
+	switch md.Proto {
+	case cluster.Proto_HTTP:
+		go (&fasthttp.Server{Handler:h,StreamRequestBody:true}).Serve(l)
+	case cluster.Proto_OO:
+		s := new(fastrpc.Server)
+		oohttp.InitServer(s,h)
+		go s.Serve(l)
+	default:
+		l.Close()
+		return 0,nil,fmt.Errorf("No such protocol %d",md.Proto)
+	}
+	return tl.Addr().(*net.TCPAddr).Port,func(){ l.Close() },nil
+}
+
+func (n *Node) mlNode() *memberlist.Node {
+	m := n.Membered()
+	return &memberlist.Node{
+		Name: n.Name,
+		Addr: loopback,
+		Port: uint16(n.port),
+		Meta: m.NodeMeta(memberlist.MetaMaxSize),
+	}
+}
+
+// Introduces n to all other living nodes, and vice versa.
+func (c *Cluster) announce(n *Node) {
+	c.mutex.Lock(); defer c.mutex.Unlock()
+	self := n.mlNode()
+	for _,o := range c.nodes {
+		if o==n || !o.Alive() { continue }
+		o.Membered().NotifyJoin(self)
+		n.Membered().NotifyJoin(o.mlNode())
+	}
+}
+
+// Tells all other living nodes, that n has left the cluster.
+func (c *Cluster) depart(n *Node) {
+	c.mutex.Lock(); defer c.mutex.Unlock()
+	self := n.mlNode()
+	for _,o := range c.nodes {
+		if o==n || !o.Alive() { continue }
+		o.Membered().NotifyLeave(self)
+	}
+}
+
+func (c *Cluster) stop(n *Node) {
+	n.mutex.Lock(); defer n.mutex.Unlock()
+	if !n.alive { return }
+	n.alive = false
+	n.closer()
+	n.closer = nil
+}
+
+func (c *Cluster) Len() int { return len(c.nodes) }
+func (c *Cluster) Node(i int) *Node { return c.nodes[i] }
+
+// Stops node i and notifies the other nodes, that it left the cluster.
+func (c *Cluster) Kill(i int) {
+	n := c.nodes[i]
+	if !n.Alive() { return }
+	c.depart(n)
+	c.stop(n)
+}
+
+// Stops node i without telling anyone. The other nodes still route to it.
+func (c *Cluster) Crash(i int) {
+	c.stop(c.nodes[i])
+}
+
+/*
+Restarts node i on the same port with a fresh Membered object, keeping its buckets.
+If the node crashed, the other nodes are told that it left before it rejoins.
+*/
+func (c *Cluster) Restart(i int) error {
+	n := c.nodes[i]
+	c.depart(n)
+	c.stop(n)
+	err := c.start(n)
+	if err!=nil { return err }
+	c.announce(n)
+	return nil
+}
+
+/*
+Returns a HttpClient talking to node i, using the cluster's transport.
+If the client has a Destroy() method, the caller should call it when done.
+*/
+func (c *Cluster) HttpClient(i int) remote.HttpClient {
+	n := c.nodes[i]
+	md := n.Membered().Meta
+	return cluster.ClientPlugins[c.cfg.Proto](&md,loopback)
+}
+
+// Returns a MultiClient, that submits through node i.
+func (c *Cluster) Client(i int) *remote.MultiClient {
+	return remote.NewMultiClient(c.HttpClient(i))
+}
+
+// Stops all nodes and removes the temporary directories.
+func (c *Cluster) Close() {
+	for _,n := range c.nodes {
+		c.stop(n)
+		for _,dir := range n.dirs { os.RemoveAll(dir) }
+		n.dirs = nil
+	}
+}
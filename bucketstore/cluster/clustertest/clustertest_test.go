@@ -0,0 +1,102 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package clustertest
+
+import "bytes"
+import "testing"
+import "time"
+import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore/cluster"
+import "github.com/maxymania/fastnntp-polyglot-labs/bufferex"
+
+func newCluster(t *testing.T, nodes int) *Cluster {
+	c,err := New(&Config{Nodes:nodes,Proto:cluster.Proto_HTTP})
+	if err!=nil { t.Fatal(err) }
+	return c
+}
+
+func get(c *Cluster, via int, bucket, id []byte) (body []byte, ok bool) {
+	var b bufferex.Binary
+	ok,err := c.Client(via).OverGet(bucket,id,nil,nil,&b)
+	if err!=nil || !ok { return nil,false }
+	defer b.Free()
+	return append([]byte(nil),b.Bytes()...),true
+}
+
+func TestJoinSubmit(t *testing.T) {
+	c := newCluster(t,3)
+	defer c.Close()
+	
+	expire := time.Now().AddDate(0,0,1)
+	bucket,err := c.Client(0).Submit([]byte("<1@test>"),[]byte("overv"),[]byte("head"),[]byte("body"),expire)
+	if err!=nil { t.Fatal(err) }
+	defer bucket.Free()
+	
+	/* Every node must route to the bucket, that holds the object. */
+	for i := 0 ; i<c.Len() ; i++ {
+		body,ok := get(c,i,bucket.Bytes(),[]byte("<1@test>"))
+		if !ok { t.Fatalf("node%d: object not found",i) }
+		if !bytes.Equal(body,[]byte("body")) { t.Fatalf("node%d: body = %q",i,body) }
+	}
+	
+	n := 0
+	for i := 0 ; i<c.Len() ; i++ {
+		for _,bu := range c.Node(i).Buckets { n += bu.Store.(*MemStore).Len() }
+	}
+	if n!=1 { t.Fatalf("%d copies stored, expected 1",n) }
+}
+
+func TestFaults(t *testing.T) {
+	c := newCluster(t,2)
+	defer c.Close()
+	
+	bucket := []byte(c.Node(1).Buckets[0].Uuid)
+	id := []byte("<2@test>")
+	err := c.Client(0).OverPut(bucket,id,nil,nil,[]byte("body"),time.Now().AddDate(0,0,1))
+	if err!=nil { t.Fatal(err) }
+	if _,ok := get(c,0,bucket,id) ; !ok { t.Fatal("object not found") }
+	
+	c.Node(1).Faults.SetLoss(1)
+	if _,ok := get(c,0,bucket,id) ; ok { t.Fatal("object found, despite of a total connection loss") }
+	c.Node(1).Faults.Clear()
+	if _,ok := get(c,0,bucket,id) ; !ok { t.Fatal("object not found after clearing the faults") }
+	
+	c.Crash(1)
+	if _,ok := get(c,0,bucket,id) ; ok { t.Fatal("object found on a crashed node") }
+	if err = c.Restart(1) ; err!=nil { t.Fatal(err) }
+	if _,ok := get(c,0,bucket,id) ; !ok { t.Fatal("object not found after restart") }
+}
+
+func TestKill(t *testing.T) {
+	c := newCluster(t,2)
+	defer c.Close()
+	
+	c.Kill(1)
+	bucket,err := c.Client(0).Submit([]byte("<3@test>"),nil,nil,[]byte("body"),time.Now().AddDate(0,0,1))
+	if err!=nil { t.Fatal(err) }
+	defer bucket.Free()
+	if string(bucket.Bytes())!=c.Node(0).Buckets[0].Uuid {
+		t.Fatalf("submitted into %q, which is not on the surviving node",bucket.Bytes())
+	}
+}
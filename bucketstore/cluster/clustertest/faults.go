@@ -0,0 +1,156 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package clustertest
+
+import "errors"
+import "math/rand"
+import "net"
+import "sync"
+import "sync/atomic"
+import "time"
+
+var EPacketLoss = errors.New("Injected connection loss")
+
+/*
+Fault injection settings of a node. All methods are safe for concurrent use,
+so the settings may be altered, while the cluster is running.
+*/
+type Faults struct{
+	latency int64  // time.Duration
+	loss    uint64 // probability, scaled to 1<<32
+	rnd     *rand.Rand
+	rndmtx  sync.Mutex
+}
+
+// Every packet or write is delayed by d.
+func (f *Faults) SetLatency(d time.Duration) {
+	atomic.StoreInt64(&f.latency,int64(d))
+}
+func (f *Faults) Latency() time.Duration {
+	return time.Duration(atomic.LoadInt64(&f.latency))
+}
+
+/*
+Sets the loss probability (0.0 - 1.0).
+
+Datagram based transports (KCP) silently drop the affected packets.
+Stream based transports (HTTP, OO) can't lose parts of the stream, so the
+affected connection is reset instead.
+*/
+func (f *Faults) SetLoss(p float64) {
+	if p<0 { p = 0 }
+	if p>1 { p = 1 }
+	atomic.StoreUint64(&f.loss,uint64(p*(1<<32)))
+}
+
+// Resets all faults.
+func (f *Faults) Clear() {
+	f.SetLatency(0)
+	f.SetLoss(0)
+}
+
+func (f *Faults) lost() bool {
+	l := atomic.LoadUint64(&f.loss)
+	if l==0 { return false }
+	f.rndmtx.Lock(); defer f.rndmtx.Unlock()
+	if f.rnd==nil { f.rnd = rand.New(rand.NewSource(time.Now().UnixNano())) }
+	return uint64(f.rnd.Uint32())<l
+}
+func (f *Faults) delay() {
+	if d := f.Latency(); d>0 { time.Sleep(d) }
+}
+
+type faultConn struct{
+	net.Conn
+	f *Faults
+	l *faultListener
+}
+func (c *faultConn) Write(b []byte) (int,error) {
+	c.f.delay()
+	if c.f.lost() {
+		c.Close()
+		return 0,EPacketLoss
+	}
+	return c.Conn.Write(b)
+}
+func (c *faultConn) Close() error {
+	c.l.forget(c)
+	return c.Conn.Close()
+}
+
+/*
+A listener, that injects faults and keeps track of the accepted connections,
+so that Close() tears down the whole server side, like a killed process would.
+*/
+type faultListener struct{
+	net.Listener
+	f     *Faults
+	mutex sync.Mutex
+	conns map[*faultConn]bool
+}
+func newFaultListener(l net.Listener, f *Faults) *faultListener {
+	return &faultListener{Listener:l,f:f,conns:make(map[*faultConn]bool)}
+}
+func (l *faultListener) Accept() (net.Conn,error) {
+	c,err := l.Listener.Accept()
+	if err!=nil { return nil,err }
+	fc := &faultConn{c,l.f,l}
+	l.mutex.Lock(); defer l.mutex.Unlock()
+	if l.conns==nil { c.Close(); return nil,EPacketLoss }
+	l.conns[fc] = true
+	return fc,nil
+}
+func (l *faultListener) forget(c *faultConn) {
+	l.mutex.Lock(); defer l.mutex.Unlock()
+	if l.conns!=nil { delete(l.conns,c) }
+}
+func (l *faultListener) Close() error {
+	err := l.Listener.Close()
+	l.mutex.Lock()
+	conns := l.conns
+	l.conns = nil
+	l.mutex.Unlock()
+	for c := range conns { c.Conn.Close() }
+	return err
+}
+
+type faultPacketConn struct{
+	net.PacketConn
+	f *Faults
+}
+func (c *faultPacketConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	for {
+		n,addr,err = c.PacketConn.ReadFrom(b)
+		if err!=nil || !c.f.lost() { return }
+	}
+}
+func (c *faultPacketConn) WriteTo(b []byte, addr net.Addr) (int,error) {
+	if c.f.lost() { return len(b),nil }
+	d := c.f.Latency()
+	if d<=0 { return c.PacketConn.WriteTo(b,addr) }
+	pkt := append([]byte(nil),b...)
+	time.AfterFunc(d,func(){ c.PacketConn.WriteTo(pkt,addr) })
+	return len(b),nil
+}
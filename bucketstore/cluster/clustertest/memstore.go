@@ -0,0 +1,134 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package clustertest
+
+import "sort"
+import "sync"
+import "time"
+import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore"
+import "github.com/maxymania/fastnntp-polyglot-labs/bufferex"
+
+type memObject struct{
+	overv, head, body []byte
+	stored time.Time
+	expire time.Time
+}
+
+/*
+An in-memory BucketStore. It survives Kill() and Restart() of the node owning it,
+just like a bucket on disk would.
+*/
+type MemStore struct{
+	mutex sync.RWMutex
+	objs  map[string]*memObject
+	used  int64
+	maxsp int64
+}
+func NewMemStore(maxSpace int64) *MemStore {
+	return &MemStore{objs:make(map[string]*memObject),maxsp:maxSpace}
+}
+
+func (m *MemStore) Put(id, overv, head, body []byte, expire time.Time) error {
+	size := int64(len(overv)+len(head)+len(body))
+	m.mutex.Lock(); defer m.mutex.Unlock()
+	if _,ok := m.objs[string(id)] ; ok { return bucketstore.EExists }
+	if m.used+size > m.maxsp { return bucketstore.EOutOfStorage }
+	obj := &memObject{
+		overv : append([]byte(nil),overv...),
+		head  : append([]byte(nil),head...),
+		body  : append([]byte(nil),body...),
+		stored: time.Now().UTC(),
+		expire: expire,
+	}
+	m.objs[string(id)] = obj
+	m.used += size
+	return nil
+}
+func (m *MemStore) Get(id []byte, overv, head, body *bufferex.Binary) (ok bool,e error) {
+	m.mutex.RLock(); defer m.mutex.RUnlock()
+	obj := m.objs[string(id)]
+	if obj==nil { return }
+	if overv!=nil { *overv = bufferex.NewBinary(obj.overv) }
+	if head !=nil { *head  = bufferex.NewBinary(obj.head ) }
+	if body !=nil { *body  = bufferex.NewBinary(obj.body ) }
+	ok = true
+	return
+}
+func (m *MemStore) Expire(expire time.Time) error {
+	m.mutex.Lock(); defer m.mutex.Unlock()
+	for id,obj := range m.objs {
+		if obj.expire.After(expire) { continue }
+		m.used -= int64(len(obj.overv)+len(obj.head)+len(obj.body))
+		delete(m.objs,id)
+	}
+	return nil
+}
+func (m *MemStore) FreeStorage() (int64,error) {
+	m.mutex.RLock(); defer m.mutex.RUnlock()
+	n := m.maxsp-m.used
+	if n<0 { n = 0 }
+	return n,nil
+}
+
+// Returns the number of objects stored in this bucket.
+func (m *MemStore) Len() int {
+	m.mutex.RLock(); defer m.mutex.RUnlock()
+	return len(m.objs)
+}
+
+// Implements bucketstore.Lister.
+func (m *MemStore) List(after []byte, targ func(id []byte, expire time.Time) bool) error {
+	return m.ListAge(after,func(id []byte, stored, expire time.Time) bool { return targ(id,expire) })
+}
+
+// Implements bucketstore.AgeLister.
+func (m *MemStore) ListAge(after []byte, targ func(id []byte, stored, expire time.Time) bool) error {
+	type entry struct{
+		id     string
+		stored time.Time
+		expire time.Time
+	}
+	m.mutex.RLock()
+	ents := make([]entry,0,len(m.objs))
+	for id,obj := range m.objs {
+		if id<=string(after) { continue }
+		ents = append(ents,entry{id,obj.stored,obj.expire})
+	}
+	m.mutex.RUnlock()
+	sort.Slice(ents,func(i,j int) bool { return ents[i].id<ents[j].id })
+	for _,ent := range ents {
+		if !targ([]byte(ent.id),ent.stored,ent.expire) { break }
+	}
+	return nil
+}
+
+// Implements bucketstore.Deleter.
+func (m *MemStore) Delete(id []byte) error {
+	m.mutex.Lock(); defer m.mutex.Unlock()
+	obj := m.objs[string(id)]
+	if obj==nil { return nil }
+	m.used -= int64(len(obj.overv)+len(obj.head)+len(obj.body))
+	delete(m.objs,string(id))
+	return nil
+}
@@ -34,7 +34,7 @@ func dial6(s string) (net.Conn,error) { return net.Dial("tcp6",s) }
 
 func ccHttp(md *MetaData,ip net.IP) remote.HttpClient {
 	addr := (&net.TCPAddr{IP:ip,Port:int(md.Port)}).String()
-	hc := &fasthttp.HostClient{Addr: addr}
+	hc := &fasthttp.HostClient{Addr: addr, StreamResponseBody: true}
 	
 	// If the address is an IPv6 address, Use IPv6-Dial. By default fasthttp uses IPv4 only.
 	if len(ip.To4())==0 { hc.Dial = dial6 }
@@ -44,6 +44,7 @@ func ccHttp(md *MetaData,ip net.IP) remote.HttpClient {
 func ccOO(md *MetaData,ip net.IP) remote.HttpClient {
 	addr := (&net.TCPAddr{IP:ip,Port:int(md.Port)}).String()
 	oc := &oohttp.Client{}
+	oc.Init()
 	oc.Inner.Addr = addr
 	
 	// If the address is an IPv6 address, Use IPv6-Dial. By default fastrpc uses IPv4 only, just like fasthttp.
@@ -34,7 +34,7 @@ import "github.com/xtaci/kcp-go"
 func lasHttp (md *MetaData,f fasthttp.RequestHandler) {
 	l,e := net.Listen("tcp",fmt.Sprintf(":%d",md.Port))
 	if e!=nil { return }
-	fasthttp.Serve(l,f)
+	(&fasthttp.Server{Handler:f,StreamRequestBody:true}).Serve(l)
 }
 func lasOO (md *MetaData,f fasthttp.RequestHandler) {
 	l,e := net.Listen("tcp",fmt.Sprintf(":%d",md.Port))
@@ -0,0 +1,223 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+/*
+Encryption at rest for buckets.
+
+A CryptStore wraps a BucketStore and encrypts the overview, head and body using AES-GCM.
+Every encrypted field carries the ID of the key, it was encrypted with, so keys can be
+rotated: new objects are encrypted with the current key, while old objects remain readable
+as long as their key stays in the keyring.
+
+Encrypted field layout:
+
+	[4 byte key ID (big endian)] [12 byte nonce] [ciphertext + 16 byte tag]
+
+The object ID and the field number are authenticated as additional data, so fields can't be
+swapped between objects. Empty fields are stored as is.
+*/
+package crypt
+
+import "crypto/aes"
+import "crypto/cipher"
+import "crypto/rand"
+import "encoding/binary"
+import "encoding/hex"
+import "errors"
+import "fmt"
+import "io"
+import "io/ioutil"
+import "strconv"
+import "sync"
+import "time"
+import "github.com/lytics/confl"
+import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore"
+import "github.com/maxymania/fastnntp-polyglot-labs/bufferex"
+
+var ENoKey = errors.New("Encryption key not in keyring")
+var ECorrupt = errors.New("Encrypted data corrupted")
+
+const (
+	idSize    = 4
+	nonceSize = 12
+	overhead  = idSize+nonceSize+16
+)
+
+var bE = binary.BigEndian
+
+/*
+The keyring file:
+
+	Current = 2
+	Keys {
+		"1" = "<64 hex digits>"
+		"2" = "<64 hex digits>"
+	}
+
+The keys are AES-128, AES-192 or AES-256 keys. Keep this file off the bucket disks.
+*/
+type KeyringConfig struct{
+	Current uint32
+	Keys    map[string]string
+}
+
+type Keyring struct{
+	mutex   sync.RWMutex
+	current uint32
+	keys    map[uint32]cipher.AEAD
+}
+func NewKeyring() *Keyring {
+	return &Keyring{keys:make(map[uint32]cipher.AEAD)}
+}
+func LoadKeyring(path string) (*Keyring,error) {
+	var cfg KeyringConfig
+	data,err := ioutil.ReadFile(path)
+	if err==nil { err = confl.Unmarshal(data,&cfg) }
+	if err!=nil { return nil,err }
+	kr := NewKeyring()
+	for sid,skey := range cfg.Keys {
+		id,err := strconv.ParseUint(sid,10,32)
+		if err!=nil { return nil,fmt.Errorf("Invalid key ID %q",sid) }
+		key,err := hex.DecodeString(skey)
+		if err!=nil { return nil,fmt.Errorf("Key %d: %v",id,err) }
+		if err = kr.AddKey(uint32(id),key) ; err!=nil { return nil,fmt.Errorf("Key %d: %v",id,err) }
+	}
+	if err = kr.SetCurrent(cfg.Current) ; err!=nil { return nil,err }
+	return kr,nil
+}
+func (k *Keyring) AddKey(id uint32, key []byte) error {
+	blk,err := aes.NewCipher(key)
+	if err!=nil { return err }
+	gcm,err := cipher.NewGCM(blk)
+	if err!=nil { return err }
+	k.mutex.Lock(); defer k.mutex.Unlock()
+	k.keys[id] = gcm
+	return nil
+}
+// Sets the key, new objects are encrypted with.
+func (k *Keyring) SetCurrent(id uint32) error {
+	k.mutex.Lock(); defer k.mutex.Unlock()
+	if _,ok := k.keys[id] ; !ok { return ENoKey }
+	k.current = id
+	return nil
+}
+func (k *Keyring) get(id uint32) cipher.AEAD {
+	k.mutex.RLock(); defer k.mutex.RUnlock()
+	return k.keys[id]
+}
+func (k *Keyring) cur() (uint32,cipher.AEAD) {
+	k.mutex.RLock(); defer k.mutex.RUnlock()
+	return k.current,k.keys[k.current]
+}
+
+func aad(id []byte, field byte) []byte {
+	return append(append(make([]byte,0,len(id)+1),id...),field)
+}
+
+func (k *Keyring) seal(id []byte, field byte, data []byte) ([]byte,error) {
+	if len(data)==0 { return data,nil }
+	kid,gcm := k.cur()
+	if gcm==nil { return nil,ENoKey }
+	out := make([]byte,idSize+nonceSize,overhead+len(data))
+	bE.PutUint32(out,kid)
+	if _,err := io.ReadFull(rand.Reader,out[idSize:]) ; err!=nil { return nil,err }
+	return gcm.Seal(out,out[idSize:],data,aad(id,field)),nil
+}
+func (k *Keyring) open(id []byte, field byte, data []byte) (bufferex.Binary,error) {
+	if len(data)==0 { return bufferex.Binary{},nil }
+	if len(data)<overhead { return bufferex.Binary{},ECorrupt }
+	gcm := k.get(bE.Uint32(data))
+	if gcm==nil { return bufferex.Binary{},ENoKey }
+	plain := bufferex.AllocBinary(len(data)-overhead)
+	_,err := gcm.Open(plain.Bytes()[:0],data[idSize:idSize+nonceSize],data[idSize+nonceSize:],aad(id,field))
+	if err!=nil { plain.Free() ; return bufferex.Binary{},ECorrupt }
+	return plain,nil
+}
+
+// An encrypting BucketStore.
+type CryptStore struct{
+	Store   bucketstore.BucketStore
+	Keyring *Keyring
+}
+func (c *CryptStore) Put(id, overv, head, body []byte, expire time.Time) (err error) {
+	var f [3][]byte
+	for i,d := range [3][]byte{overv,head,body} {
+		f[i],err = c.Keyring.seal(id,byte(i),d)
+		if err!=nil { return }
+	}
+	return c.Store.Put(id,f[0],f[1],f[2],expire)
+}
+func (c *CryptStore) Get(id []byte, overv, head, body *bufferex.Binary) (ok bool,e error) {
+	var enc [3]bufferex.Binary
+	var penc [3]*bufferex.Binary
+	ptrs := [3]*bufferex.Binary{overv,head,body}
+	for i,p := range ptrs {
+		if p!=nil { penc[i] = &enc[i] }
+	}
+	ok,e = c.Store.Get(id,penc[0],penc[1],penc[2])
+	defer enc[0].Free()
+	defer enc[1].Free()
+	defer enc[2].Free()
+	if e!=nil || !ok { return }
+	for i,p := range ptrs {
+		if p==nil { continue }
+		*p,e = c.Keyring.open(id,byte(i),enc[i].Bytes())
+		if e==nil { continue }
+		for _,q := range ptrs[:i] {
+			if q!=nil { q.Free() ; *q = bufferex.Binary{} }
+		}
+		return false,e
+	}
+	return
+}
+func (c *CryptStore) Expire(expire time.Time) error { return c.Store.Expire(expire) }
+func (c *CryptStore) FreeStorage() (int64,error) { return c.Store.FreeStorage() }
+
+// Passed through, if supported by the underlying store.
+func (c *CryptStore) List(after []byte, targ func(id []byte, expire time.Time) bool) error {
+	if l,ok := c.Store.(bucketstore.Lister) ; ok { return l.List(after,targ) }
+	return bucketstore.ENotSupported
+}
+func (c *CryptStore) ListAge(after []byte, targ func(id []byte, stored, expire time.Time) bool) error {
+	if l,ok := c.Store.(bucketstore.AgeLister) ; ok { return l.ListAge(after,targ) }
+	return bucketstore.ENotSupported
+}
+func (c *CryptStore) Delete(id []byte) error {
+	if d,ok := c.Store.(bucketstore.Deleter) ; ok { return d.Delete(id) }
+	return bucketstore.ENotSupported
+}
+
+/*
+Registers the backend "crypt-<kind>", which stacks a CryptStore on top of the (already
+registered) backend kind, eg. "crypt-dayfile" or "crypt-dayfilemulti".
+Since the kind is recorded in "guid.cfg", an encrypted bucket can't be opened without it.
+*/
+func Register(kind string, kr *Keyring) {
+	loader := bucketstore.Backends[kind]
+	if loader==nil { return }
+	bucketstore.Backends["crypt-"+kind] = func(path string, cfg *bucketstore.Config) (bucketstore.BucketStore,error) {
+		st,err := loader(path,cfg)
+		if err!=nil { return nil,err }
+		return &CryptStore{st,kr},nil
+	}
+	bucketstore.Formats["crypt-"+kind] = bucketstore.Formats[kind]
+}
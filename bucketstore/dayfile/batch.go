@@ -0,0 +1,122 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package dayfile
+
+import "time"
+import "github.com/boltdb/bolt"
+import "github.com/vmihailenco/msgpack"
+import "github.com/maxymania/fastnntp-polyglot-labs/bufferex"
+import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore"
+
+/* A contiguous region of a dayfile, written at once. */
+type batchRun struct{
+	off int64
+	buf []byte
+}
+
+/*
+Checks an item before the transaction, so a malformed item fails on its own
+instead of rolling back the whole batch.
+*/
+func (d *DayfileIndex) checkItem(it *bucketstore.Item) error {
+	if len(it.Id)==0 || len(it.Id)+len(DayID{})>bolt.MaxKeySize { return bucketstore.EBadRequest }
+	return nil
+}
+
+/*
+Implements bucketstore.BatchPutter. All items are stored within one transaction, and the items
+of one dayfile are written with one sequential write. If the transaction fails, none of the items
+are stored.
+*/
+func (d *DayfileIndex) PutMany(items []bucketstore.Item) []error {
+	errs := make([]error,len(items))
+	pos := make([]Position,len(items))
+	for i := range items { errs[i] = d.checkItem(&items[i]) }
+	e := d.db.Update(func(tx *bolt.Tx) error {
+		var ibuf [8]byte
+		fSz,err := tx.CreateBucketIfNotExists(bktFileSize)
+		if err!=nil { return err }
+		idx,err := tx.CreateBucketIfNotExists(bktIndex)
+		if err!=nil { return err }
+		idxrel,err := tx.CreateBucketIfNotExists(bktIndexRel)
+		if err!=nil { return err }
+		
+		now := time.Now().Unix()
+		seen := make(map[string]bool)
+		runs := make(map[DayID]*batchRun)
+		
+		for i := range items {
+			it := &items[i]
+			if errs[i]!=nil { continue }
+			if len(idx.Get(it.Id))!=0 || seen[string(it.Id)] { errs[i] = bucketstore.EExists ; continue }
+			p := &pos[i]
+			it.Expire.UTC().AppendFormat(p.Day[:0],dayFile_Fmt)
+			total := int64(len(it.Over)+len(it.Head)+len(it.Body))
+			
+			copy(ibuf[:],fSz.Get(p.Day[:]))
+			p.Offset = int64(bE.Uint64(ibuf[:]))
+			seen[string(it.Id)] = true
+			p.Over,p.Head,p.Body,p.Stored = len(it.Over),len(it.Head),len(it.Body),now
+			
+			bE.PutUint64(ibuf[:],uint64(p.Offset+total))
+			err = fSz.Put(p.Day[:],ibuf[:])
+			if err!=nil { return err }
+			
+			/* Offsets within one dayfile are handed out consecutively, so the run stays contiguous. */
+			r := runs[p.Day]
+			if r==nil { r = &batchRun{off:p.Offset} ; runs[p.Day] = r }
+			r.buf = append(append(append(r.buf,it.Over...),it.Head...),it.Body...)
+		}
+		
+		for day,r := range runs {
+			f,err := d.open(day)
+			if err!=nil { return err }
+			_,err = f.WriteAt(r.buf,r.off)
+			f.Close()
+			if err!=nil { return err }
+		}
+		
+		for i := range items {
+			if errs[i]!=nil { continue }
+			id := items[i].Id
+			buf,_ := msgpack.Marshal(&pos[i])
+			err = idx.Put(id,buf)
+			if err!=nil { return err }
+			relid := bufferex.AllocBinary(len(id)+len(pos[i].Day))
+			copy(relid.Bytes(),pos[i].Day[:])
+			copy(relid.Bytes()[len(pos[i].Day):],id)
+			err = idxrel.Put(relid.Bytes(),id)
+			relid.Free()
+			if err!=nil { return err }
+		}
+		return nil
+	})
+	if e!=nil {
+		for i := range errs {
+			if errs[i]==nil { errs[i] = e }
+		}
+	}
+	return errs
+}
@@ -0,0 +1,122 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package dayfile
+
+import "bytes"
+import "time"
+import "github.com/boltdb/bolt"
+import "github.com/vmihailenco/msgpack"
+import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore"
+
+/*
+ * Scan tokens consist of a mode byte followed by the last key visited:
+ * 'i' - the key of the "index" bucket (the object ID).
+ * 'r' - the key of the "indexrel" bucket (DayID+ID).
+ */
+const (
+	scanIndex = 'i'
+	scanRel   = 'r'
+)
+
+/*
+Implements bucketstore.Scanner. Without filter, the objects are enumerated in the order of their IDs,
+through the "index" bucket. With an expiry filter, they are enumerated in the order of their dayfiles,
+through the "indexrel" bucket, so that only the dayfiles within the range are visited.
+*/
+func (d *DayfileIndex) Scan(token []byte, filter bucketstore.ScanFilter, limit int) (entries []bucketstore.ScanEntry, next []byte, e error) {
+	if limit<=0 { limit = listPage }
+	mode := byte(scanIndex)
+	if !filter.ExpireFrom.IsZero() || !filter.ExpireTo.IsZero() { mode = scanRel }
+	if len(token)>0 && token[0]!=mode { return nil,nil,bucketstore.EBadRequest }
+	
+	var from,to [len(dayFile_Fmt)]byte
+	filter.ExpireFrom.UTC().AppendFormat(from[:0],dayFile_Fmt)
+	filter.ExpireTo.UTC().AppendFormat(to[:0],dayFile_Fmt)
+	
+	e = d.db.View(func(tx *bolt.Tx) error {
+		idx := tx.Bucket(bktIndex)
+		if idx==nil { return nil }
+		var cur *bolt.Cursor
+		if mode==scanRel {
+			idxrel := tx.Bucket(bktIndexRel)
+			if idxrel==nil { return nil }
+			cur = idxrel.Cursor()
+		} else {
+			cur = idx.Cursor()
+		}
+		
+		var key,val []byte
+		switch {
+		case len(token)>1:
+			key,val = cur.Seek(token[1:])
+			if bytes.Equal(key,token[1:]) { key,val = cur.Next() }
+		case mode==scanRel && !filter.ExpireFrom.IsZero():
+			key,val = cur.Seek(from[:])
+		default:
+			key,val = cur.First()
+		}
+		
+		var pos Position
+		var last []byte
+		for ; len(key)>0 ; key,val = cur.Next() {
+			if len(entries)==limit { next = last ; return nil }
+			id := key
+			if mode==scanRel {
+				/* The dayfiles are sorted by date, nothing beyond ExpireTo can match. */
+				if !filter.ExpireTo.IsZero() && len(key)>=len(to) && bytes.Compare(key[:len(to)],to[:])>0 { return nil }
+				id = val
+				val = idx.Get(id)
+			}
+			pos = Position{} // Older records lack the trailing fields (Stored).
+			if msgpack.Unmarshal(val,&pos)!=nil { continue }
+			t,err := time.ParseInLocation(dayFile_Fmt,string(pos.Day[:len(dayFile_Fmt)]),time.UTC)
+			if err!=nil || !filter.Match(t) { continue }
+			var st time.Time
+			if pos.Stored!=0 { st = time.Unix(pos.Stored,0).UTC() }
+			entries = append(entries,bucketstore.ScanEntry{Id:append([]byte(nil),id...),Over:pos.Over,Head:pos.Head,Body:pos.Body,Stored:st,Expire:t})
+			last = append(append(last[:0],mode),key...)
+		}
+		return nil
+	})
+	if e!=nil { return nil,nil,e }
+	return
+}
+
+// Implements bucketstore.Stater.
+func (d *DayfileIndex) Stat(id []byte) (st bucketstore.ObjectStat, ok bool, e error) {
+	var pos Position
+	e = d.db.View(func(tx *bolt.Tx) error {
+		idx := tx.Bucket(bktIndex)
+		if idx==nil { return nil }
+		if msgpack.Unmarshal(idx.Get(id),&pos)!=nil { return nil }
+		ok = true
+		return nil
+	})
+	if e!=nil || !ok { return }
+	st.Over,st.Head,st.Body = pos.Over,pos.Head,pos.Body
+	st.Expire,_ = time.ParseInLocation(dayFile_Fmt,string(pos.Day[:len(dayFile_Fmt)]),time.UTC)
+	if pos.Stored!=0 { st.Stored = time.Unix(pos.Stored,0).UTC() }
+	return
+}
@@ -78,6 +78,7 @@ type Position struct{
 	Day DayID
 	Offset int64
 	Over, Head, Body int
+	Stored int64 // Unix time, the object has been stored at. 0 = unknown.
 }
 
 func evictFile (key interface{}, value interface{}) {
@@ -116,6 +117,7 @@ func openDayfileBucket(path string, cfg *bucketstore.Config) (bucketstore.Bucket
 }
 func init(){
 	bucketstore.Backends["dayfilemulti"] = openDayfileBucket
+	bucketstore.Formats["dayfilemulti"] = 1
 }
 
 func (d *DayfileIndex) open(dayid DayID) (*file.File,error) {
@@ -167,7 +169,7 @@ func (d *DayfileIndex) Put(id, overv, head, body []byte, expire time.Time) error
 			goto restart
 		}
 		
-		pos := Position{struct{}{},dayid,lng,len(overv),len(head),len(body)}
+		pos := Position{struct{}{},dayid,lng,len(overv),len(head),len(body),time.Now().Unix()}
 		
 		f,e := d.open(dayid)
 		if e!=nil { return e }
@@ -295,3 +297,49 @@ func (d *DayfileIndex) FreeStorage() (int64,error){
 	if n<0 { n = 0 }
 	return n,nil
 }
+
+const listPage = 256
+
+/*
+Implements bucketstore.Lister. The objects are enumerated in the order of their IDs.
+The index is read page by page, so that no transaction is held open while targ runs.
+*/
+func (d *DayfileIndex) List(after []byte, targ func(id []byte, expire time.Time) bool) error {
+	return d.ListAge(after,func(id []byte, stored, expire time.Time) bool { return targ(id,expire) })
+}
+
+// Implements bucketstore.AgeLister. Pages through Scan.
+func (d *DayfileIndex) ListAge(after []byte, targ func(id []byte, stored, expire time.Time) bool) error {
+	var token []byte
+	if len(after)>0 { token = append([]byte{scanIndex},after...) }
+	for {
+		page,next,e := d.Scan(token,bucketstore.ScanFilter{},listPage)
+		if e!=nil { return e }
+		for _,ent := range page {
+			if !targ(ent.Id,ent.Stored,ent.Expire) { return nil }
+		}
+		if next==nil { return nil }
+		token = next
+	}
+}
+
+/*
+Implements bucketstore.Deleter. Only the index entry is removed, the space is reclaimed,
+when the dayfile expires.
+*/
+func (d *DayfileIndex) Delete(id []byte) error {
+	return d.db.Batch(func(tx *bolt.Tx) error {
+		idx := tx.Bucket(bktIndex)
+		if idx==nil { return nil }
+		idxrel := tx.Bucket(bktIndexRel)
+		if idxrel==nil { return nil }
+		var pos Position
+		if msgpack.Unmarshal(idx.Get(id),&pos)!=nil { return nil }
+		relid := bufferex.AllocBinary(len(id)+len(pos.Day))
+		defer relid.Free()
+		copy(relid.Bytes(),pos.Day[:])
+		copy(relid.Bytes()[len(pos.Day):],id)
+		if err := idxrel.Delete(relid.Bytes()) ; err!=nil { return err }
+		return idx.Delete(id)
+	})
+}
@@ -0,0 +1,164 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package dayfile
+
+import "io"
+import "time"
+import "github.com/boltdb/bolt"
+import "github.com/vmihailenco/msgpack"
+import "github.com/maxymania/fastnntp-polyglot-labs/file"
+import "github.com/maxymania/fastnntp-polyglot-labs/bufferex"
+import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore"
+
+type offsetWriter struct{
+	w   io.WriterAt
+	off int64
+}
+func (o *offsetWriter) Write(p []byte) (n int,err error) {
+	n,err = o.w.WriteAt(p,o.off)
+	o.off += int64(n)
+	return
+}
+
+type sectionCloser struct{
+	*io.SectionReader
+	f *file.File
+}
+func (s sectionCloser) Close() error { return s.f.Close() }
+
+// Implements bucketstore.StreamGetter. The body is read from the dayfile through an io.SectionReader.
+func (d *DayfileIndex) GetReader(id []byte, overv, head *bufferex.Binary) (body io.ReadCloser, size int64, ok bool, e error) {
+	var pos Position
+	e = d.db.View(func(tx *bolt.Tx) error {
+		idx := tx.Bucket(bktIndex)
+		if idx==nil { return nil }
+		if msgpack.Unmarshal(idx.Get(id),&pos)!=nil { return nil }
+		ok = true
+		return nil
+	})
+	if e!=nil || !ok { return }
+	var f *file.File
+	f,e = d.open(pos.Day)
+	if e!=nil { ok = false ; return }
+	if overv!=nil {
+		*overv = bufferex.AllocBinary(pos.Over)
+		_,e = f.ReadAt(overv.Bytes(),pos.Offset)
+		if e!=nil { f.Close() ; ok = false ; return }
+	}
+	if head!=nil {
+		*head = bufferex.AllocBinary(pos.Head)
+		_,e = f.ReadAt(head.Bytes(),pos.Offset+int64(pos.Over))
+		if e!=nil { f.Close() ; ok = false ; return }
+	}
+	size = int64(pos.Body)
+	body = sectionCloser{io.NewSectionReader(f,pos.Offset+int64(pos.Over+pos.Head),size),f}
+	return
+}
+
+/*
+Implements bucketstore.StreamPutter. Unlike Put, the body is not written within a transaction:
+First, the space is reserved, then the object is written and finally it is inserted into the index.
+If the process crashes in between, the reserved space is lost until the dayfile expires.
+*/
+func (d *DayfileIndex) PutReader(id, overv, head []byte, body io.Reader, size int64, expire time.Time) error {
+	pos,e := d.reserve(id,int64(len(overv)+len(head))+size,expire)
+	if e!=nil { return e }
+	pos.Over,pos.Head,pos.Body = len(overv),len(head),int(size)
+	
+	f,e := d.open(pos.Day)
+	if e!=nil { return e }
+	defer f.Close()
+	w := &offsetWriter{f,pos.Offset}
+	if _,e = w.Write(overv) ; e!=nil { return e }
+	if _,e = w.Write(head) ; e!=nil { return e }
+	n,e := io.Copy(w,io.LimitReader(body,size))
+	if e!=nil { return e }
+	if n!=size { return io.ErrUnexpectedEOF }
+	
+	return d.insert(id,pos)
+}
+func (d *DayfileIndex) insert(id []byte, pos *Position) error {
+	var e2 error
+	e := d.db.Batch(func(tx *bolt.Tx) error {
+		idx,err := tx.CreateBucketIfNotExists(bktIndex)
+		if err!=nil { return err }
+		idxrel,err := tx.CreateBucketIfNotExists(bktIndexRel)
+		if err!=nil { return err }
+		
+		/* Someone else stored the same object concurrently. */
+		if len(idx.Get(id))!=0 { e2 = bucketstore.EExists ; return nil }
+		
+		buf,_ := msgpack.Marshal(pos)
+		err = idx.Put(id,buf)
+		if err!=nil { return err }
+		relid := bufferex.AllocBinary(len(id)+len(pos.Day))
+		defer relid.Free()
+		copy(relid.Bytes(),pos.Day[:])
+		copy(relid.Bytes()[len(pos.Day):],id)
+		return idxrel.Put(relid.Bytes(),id)
+	})
+	if e==nil { e=e2 }
+	return e
+}
+func (d *DayfileIndex) reserve(id []byte, total int64, expire time.Time) (*Position,error) {
+	pos := &Position{Stored:time.Now().Unix()}
+	expire.UTC().AppendFormat(pos.Day[:0],dayFile_Fmt)
+	copy(pos.Day[dfDate:],dfNumbConst)
+	var e2 error
+	e := d.db.Update(func(tx *bolt.Tx) error {
+		var ibuf [8]byte
+		fSz,err := tx.CreateBucketIfNotExists(bktFileSize)
+		if err!=nil { return err }
+		idx,err := tx.CreateBucketIfNotExists(bktIndex)
+		if err!=nil { return err }
+		
+		if len(idx.Get(id))!=0 { e2 = bucketstore.EExists ; return nil }
+		
+		for {
+			copy(ibuf[:],fSz.Get(pos.Day[:]))
+			pos.Offset = int64(bE.Uint64(ibuf[:]))
+			
+			/* Remember: we have a maximum file size, that we must not exceed. */
+			if (total+pos.Offset) <= d.maxfz { break }
+			pos.Day = pos.Day.incr()
+			if pos.Day.overfl() { e2 = bucketstore.ETemporaryFailure ; return nil }
+		}
+		bE.PutUint64(ibuf[:],uint64(pos.Offset+total))
+		return fSz.Put(pos.Day[:],ibuf[:])
+	})
+	if e==nil { e=e2 }
+	return pos,e
+}
+
+// Implements bucketstore.RangeGetter. The range is read in place, from within the body in the dayfile.
+func (d *DayfileIndex) GetRange(id []byte, off, length int64) (body io.ReadCloser, size int64, ok bool, e error) {
+	body,size,ok,e = d.GetReader(id,nil,nil)
+	if e!=nil || !ok { return }
+	sc := body.(sectionCloser)
+	off,length,e = bucketstore.ClipRange(off,length,size)
+	if e!=nil { sc.Close() ; return nil,0,false,e }
+	body = sectionCloser{io.NewSectionReader(sc.SectionReader,off,length),sc.f}
+	return
+}
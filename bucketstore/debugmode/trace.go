@@ -0,0 +1,198 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package debugmode
+
+import "fmt"
+import "io"
+import "sync"
+import "sync/atomic"
+import "time"
+import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore"
+import "github.com/maxymania/fastnntp-polyglot-labs/bufferex"
+
+// A traced operation.
+type Event struct{
+	Op      string
+	Bucket  []byte // nil for BucketStore operations.
+	Id      []byte
+	Size    [3]int    // Sizes of overview, head and body.
+	Data    [3][]byte // Overview, head and body. nil, if redacted.
+	Ok      bool      // Get: object found.
+	Err     error
+	Start   time.Time
+	Latency time.Duration
+	Slow    bool
+}
+
+// A pluggable structured logger.
+type Logger interface{
+	Trace(ev *Event)
+}
+type LoggerFunc func(ev *Event)
+func (l LoggerFunc) Trace(ev *Event) { l(ev) }
+
+// Writes one "key=value" line per event.
+type TextLogger struct{
+	W     io.Writer
+	mutex sync.Mutex
+}
+func (l *TextLogger) Trace(ev *Event) {
+	l.mutex.Lock(); defer l.mutex.Unlock()
+	fmt.Fprintf(l.W,"time=%s op=%s",ev.Start.UTC().Format(time.RFC3339Nano),ev.Op)
+	if ev.Bucket!=nil { fmt.Fprintf(l.W," bucket=%s",ev.Bucket) }
+	if ev.Id!=nil { fmt.Fprintf(l.W," id=%q",ev.Id) }
+	fmt.Fprintf(l.W," latency=%s over=%d head=%d body=%d ok=%v",ev.Latency,ev.Size[0],ev.Size[1],ev.Size[2],ev.Ok)
+	if ev.Err!=nil { fmt.Fprintf(l.W," err=%q",ev.Err.Error()) }
+	if ev.Slow { fmt.Fprint(l.W," slow=true") }
+	for i,n := range [3]string{"over","head","body"} {
+		if ev.Data[i]!=nil { fmt.Fprintf(l.W," %s_data=%q",n,ev.Data[i]) }
+	}
+	fmt.Fprintln(l.W)
+}
+
+/*
+Tracing configuration. Failed and slow operations are always logged,
+other operations are sampled.
+*/
+type Tracer struct{
+	Logger Logger
+	Sample int           // Log one of Sample operations. <=1: log all.
+	Slow   time.Duration // Operations taking at least Slow are flagged as slow. 0 = disabled.
+	Payload bool         // Log payloads. Off by default, as articles may contain private data.
+	
+	n uint32
+}
+func (t *Tracer) end(ev *Event, data ...[]byte) {
+	ev.Latency = time.Since(ev.Start)
+	ev.Slow = t.Slow>0 && ev.Latency>=t.Slow
+	log := ev.Err!=nil || ev.Slow || t.Sample<=1
+	if !log { log = (atomic.AddUint32(&t.n,1)%uint32(t.Sample))==0 }
+	if !log || t.Logger==nil { return }
+	for i,d := range data {
+		ev.Size[i] = len(d)
+		if t.Payload { ev.Data[i] = d }
+	}
+	t.Logger.Trace(ev)
+}
+
+// Traces every method of an OverStore (and the optional ones, see traceopt.go).
+type OverStoreTrace struct{
+	bucketstore.OverStore
+	T *Tracer
+}
+func (ov OverStoreTrace) Submit(id, overv, head, body []byte, expire time.Time) (bucket bufferex.Binary,err error) {
+	ev := Event{Op:"Submit",Id:id,Start:time.Now()}
+	bucket,err = ov.OverStore.Submit(id,overv,head,body,expire)
+	ev.Bucket,ev.Err,ev.Ok = bucket.Bytes(),err,err==nil
+	ov.T.end(&ev,overv,head,body)
+	return
+}
+func (ov OverStoreTrace) SubmitClass(class string, id, overv, head, body []byte, expire time.Time) (bucket bufferex.Binary,err error) {
+	ev := Event{Op:"SubmitClass:"+class,Id:id,Start:time.Now()}
+	if cs,ok := ov.OverStore.(bucketstore.ClassSubmitter) ; ok {
+		bucket,err = cs.SubmitClass(class,id,overv,head,body,expire)
+	} else {
+		bucket,err = ov.OverStore.Submit(id,overv,head,body,expire)
+	}
+	ev.Bucket,ev.Err,ev.Ok = bucket.Bytes(),err,err==nil
+	ov.T.end(&ev,overv,head,body)
+	return
+}
+func (ov OverStoreTrace) OverPut(bucket []byte, id, overv, head, body []byte, expire time.Time) error {
+	ev := Event{Op:"OverPut",Bucket:bucket,Id:id,Start:time.Now()}
+	ev.Err = ov.OverStore.OverPut(bucket,id,overv,head,body,expire)
+	ev.Ok = ev.Err==nil
+	ov.T.end(&ev,overv,head,body)
+	return ev.Err
+}
+func (ov OverStoreTrace) OverGet(bucket []byte, id []byte, overv, head, body *bufferex.Binary) (ok bool, e error) {
+	ev := Event{Op:"OverGet",Bucket:bucket,Id:id,Start:time.Now()}
+	ok,e = ov.OverStore.OverGet(bucket,id,overv,head,body)
+	ev.Ok,ev.Err = ok,e
+	ov.T.end(&ev,bytes(overv),bytes(head),bytes(body))
+	return
+}
+func (ov OverStoreTrace) OverExpire(bucket []byte, expire time.Time) error {
+	ev := Event{Op:"OverExpire",Bucket:bucket,Start:time.Now()}
+	ev.Err = ov.OverStore.OverExpire(bucket,expire)
+	ev.Ok = ev.Err==nil
+	ov.T.end(&ev)
+	return ev.Err
+}
+func (ov OverStoreTrace) OverFreeStorage(bucket []byte) (n int64,err error) {
+	ev := Event{Op:"OverFreeStorage",Bucket:bucket,Start:time.Now()}
+	n,err = ov.OverStore.OverFreeStorage(bucket)
+	ev.Ok,ev.Err = err==nil,err
+	ov.T.end(&ev)
+	return
+}
+func (ov OverStoreTrace) OverDelete(bucket []byte, id []byte) error {
+	ev := Event{Op:"OverDelete",Bucket:bucket,Id:id,Start:time.Now()}
+	ev.Err = bucketstore.ENotSupported
+	if d,ok := ov.OverStore.(bucketstore.OverDeleter) ; ok { ev.Err = d.OverDelete(bucket,id) }
+	ev.Ok = ev.Err==nil
+	ov.T.end(&ev)
+	return ev.Err
+}
+
+// Traces every method of a BucketStore (and the optional ones, see traceopt.go).
+type BucketStoreTrace struct{
+	bucketstore.BucketStore
+	T *Tracer
+}
+func (bs BucketStoreTrace) Put(id, overv, head, body []byte, expire time.Time) error {
+	ev := Event{Op:"Put",Id:id,Start:time.Now()}
+	ev.Err = bs.BucketStore.Put(id,overv,head,body,expire)
+	ev.Ok = ev.Err==nil
+	bs.T.end(&ev,overv,head,body)
+	return ev.Err
+}
+func (bs BucketStoreTrace) Get(id []byte, overv, head, body *bufferex.Binary) (ok bool,e error) {
+	ev := Event{Op:"Get",Id:id,Start:time.Now()}
+	ok,e = bs.BucketStore.Get(id,overv,head,body)
+	ev.Ok,ev.Err = ok,e
+	bs.T.end(&ev,bytes(overv),bytes(head),bytes(body))
+	return
+}
+func (bs BucketStoreTrace) Expire(expire time.Time) error {
+	ev := Event{Op:"Expire",Start:time.Now()}
+	ev.Err = bs.BucketStore.Expire(expire)
+	ev.Ok = ev.Err==nil
+	bs.T.end(&ev)
+	return ev.Err
+}
+func (bs BucketStoreTrace) FreeStorage() (n int64,err error) {
+	ev := Event{Op:"FreeStorage",Start:time.Now()}
+	n,err = bs.BucketStore.FreeStorage()
+	ev.Ok,ev.Err = err==nil,err
+	bs.T.end(&ev)
+	return
+}
+func (bs BucketStoreTrace) Delete(id []byte) error {
+	ev := Event{Op:"Delete",Id:id,Start:time.Now()}
+	ev.Err = bucketstore.ENotSupported
+	if d,ok := bs.BucketStore.(bucketstore.Deleter) ; ok { ev.Err = d.Delete(id) }
+	ev.Ok = ev.Err==nil
+	bs.T.end(&ev)
+	return ev.Err
+}
@@ -0,0 +1,149 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package debugmode
+
+import "io"
+import "time"
+import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore"
+import "github.com/maxymania/fastnntp-polyglot-labs/bufferex"
+
+/*
+Traced pass-throughs of the optional interfaces. The wrapped store is asked through the helpers
+of the bucketstore package, so the fallbacks are the same as without the tracer.
+*/
+
+func firstErr(errs []error) error {
+	for _,err := range errs {
+		if err!=nil { return err }
+	}
+	return nil
+}
+
+/* ---------------------------------------- OverStoreTrace ---------------------------------------- */
+
+func (ov OverStoreTrace) OverGetReader(bucket []byte, id []byte, overv, head *bufferex.Binary) (body io.ReadCloser, size int64, ok bool, e error) {
+	ev := Event{Op:"OverGetReader",Bucket:bucket,Id:id,Start:time.Now()}
+	body,size,ok,e = bucketstore.OverGetReader(ov.OverStore,bucket,id,overv,head)
+	ev.Ok,ev.Err,ev.Size[2] = ok,e,int(size)
+	ov.T.end(&ev,bytes(overv),bytes(head))
+	return
+}
+func (ov OverStoreTrace) OverPutReader(bucket []byte, id, overv, head []byte, body io.Reader, size int64, expire time.Time) error {
+	ev := Event{Op:"OverPutReader",Bucket:bucket,Id:id,Start:time.Now()}
+	ev.Err = bucketstore.OverPutReader(ov.OverStore,bucket,id,overv,head,body,size,expire)
+	ev.Ok,ev.Size[2] = ev.Err==nil,int(size)
+	ov.T.end(&ev,overv,head)
+	return ev.Err
+}
+func (ov OverStoreTrace) OverGetRange(bucket []byte, id []byte, off, length int64) (body io.ReadCloser, size int64, ok bool, e error) {
+	ev := Event{Op:"OverGetRange",Bucket:bucket,Id:id,Start:time.Now()}
+	body,size,ok,e = bucketstore.OverGetRange(ov.OverStore,bucket,id,off,length)
+	ev.Ok,ev.Err,ev.Size[2] = ok,e,int(size)
+	ov.T.end(&ev)
+	return
+}
+func (ov OverStoreTrace) OverPutMany(bucket []byte, items []bucketstore.Item) []error {
+	ev := Event{Op:"OverPutMany",Bucket:bucket,Start:time.Now()}
+	errs := bucketstore.OverPutMany(ov.OverStore,bucket,items)
+	ev.Err = firstErr(errs)
+	ev.Ok = ev.Err==nil
+	ov.T.end(&ev)
+	return errs
+}
+func (ov OverStoreTrace) OverScan(bucket []byte, token []byte, filter bucketstore.ScanFilter, limit int) (entries []bucketstore.ScanEntry, next []byte, e error) {
+	ev := Event{Op:"OverScan",Bucket:bucket,Start:time.Now()}
+	entries,next,e = bucketstore.OverScan(ov.OverStore,bucket,token,filter,limit)
+	ev.Ok,ev.Err = e==nil,e
+	ov.T.end(&ev)
+	return
+}
+func (ov OverStoreTrace) OverStat(bucket []byte, id []byte) (st bucketstore.ObjectStat, ok bool, e error) {
+	ev := Event{Op:"OverStat",Bucket:bucket,Id:id,Start:time.Now()}
+	st,ok,e = bucketstore.OverStat(ov.OverStore,bucket,id)
+	ev.Ok,ev.Err = ok,e
+	ov.T.end(&ev)
+	return
+}
+
+/* --------------------------------------- BucketStoreTrace --------------------------------------- */
+
+func (bs BucketStoreTrace) List(after []byte, targ func(id []byte, expire time.Time) bool) error {
+	ev := Event{Op:"List",Id:after,Start:time.Now()}
+	ev.Err = bucketstore.ENotSupported
+	if l,ok := bs.BucketStore.(bucketstore.Lister) ; ok { ev.Err = l.List(after,targ) }
+	ev.Ok = ev.Err==nil
+	bs.T.end(&ev)
+	return ev.Err
+}
+func (bs BucketStoreTrace) ListAge(after []byte, targ func(id []byte, stored, expire time.Time) bool) error {
+	ev := Event{Op:"ListAge",Id:after,Start:time.Now()}
+	ev.Err = bucketstore.ENotSupported
+	if l,ok := bs.BucketStore.(bucketstore.AgeLister) ; ok { ev.Err = l.ListAge(after,targ) }
+	ev.Ok = ev.Err==nil
+	bs.T.end(&ev)
+	return ev.Err
+}
+func (bs BucketStoreTrace) GetReader(id []byte, overv, head *bufferex.Binary) (body io.ReadCloser, size int64, ok bool, e error) {
+	ev := Event{Op:"GetReader",Id:id,Start:time.Now()}
+	body,size,ok,e = bucketstore.GetReader(bs.BucketStore,id,overv,head)
+	ev.Ok,ev.Err,ev.Size[2] = ok,e,int(size)
+	bs.T.end(&ev,bytes(overv),bytes(head))
+	return
+}
+func (bs BucketStoreTrace) PutReader(id, overv, head []byte, body io.Reader, size int64, expire time.Time) error {
+	ev := Event{Op:"PutReader",Id:id,Start:time.Now()}
+	ev.Err = bucketstore.PutReader(bs.BucketStore,id,overv,head,body,size,expire)
+	ev.Ok,ev.Size[2] = ev.Err==nil,int(size)
+	bs.T.end(&ev,overv,head)
+	return ev.Err
+}
+func (bs BucketStoreTrace) GetRange(id []byte, off, length int64) (body io.ReadCloser, size int64, ok bool, e error) {
+	ev := Event{Op:"GetRange",Id:id,Start:time.Now()}
+	body,size,ok,e = bucketstore.GetRange(bs.BucketStore,id,off,length)
+	ev.Ok,ev.Err,ev.Size[2] = ok,e,int(size)
+	bs.T.end(&ev)
+	return
+}
+func (bs BucketStoreTrace) PutMany(items []bucketstore.Item) []error {
+	ev := Event{Op:"PutMany",Start:time.Now()}
+	errs := bucketstore.PutMany(bs.BucketStore,items)
+	ev.Err = firstErr(errs)
+	ev.Ok = ev.Err==nil
+	bs.T.end(&ev)
+	return errs
+}
+func (bs BucketStoreTrace) Scan(token []byte, filter bucketstore.ScanFilter, limit int) (entries []bucketstore.ScanEntry, next []byte, e error) {
+	ev := Event{Op:"Scan",Start:time.Now()}
+	entries,next,e = bucketstore.Scan(bs.BucketStore,token,filter,limit)
+	ev.Ok,ev.Err = e==nil,e
+	bs.T.end(&ev)
+	return
+}
+func (bs BucketStoreTrace) Stat(id []byte) (st bucketstore.ObjectStat, ok bool, e error) {
+	ev := Event{Op:"Stat",Id:id,Start:time.Now()}
+	st,ok,e = bucketstore.Stat(bs.BucketStore,id)
+	ev.Ok,ev.Err = ok,e
+	bs.T.end(&ev)
+	return
+}
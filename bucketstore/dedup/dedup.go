@@ -0,0 +1,277 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+/*
+Content-addressed body deduplication.
+
+A DedupStore wraps a BucketStore. Bodies of at least Threshold bytes are hashed (SHA-256)
+and stored once in "dedup.db" inside the bucket directory, with a reference count; the
+underlying store only holds a reference. Smaller bodies are stored inline.
+References are indexed by their expiry day, so Expire (and Delete) release them.
+
+The body stored in the underlying store is prefixed with one byte: 0 = inline body,
+1 = reference (followed by the hash).
+
+The unique bodies in "dedup.db" are not encrypted by crypt.CryptStore.
+*/
+package dedup
+
+import "crypto/sha256"
+import "encoding/binary"
+import "path/filepath"
+import "time"
+import "github.com/boltdb/bolt"
+import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore"
+import "github.com/maxymania/fastnntp-polyglot-labs/bufferex"
+
+const (
+	tagInline = 0
+	tagRef    = 1
+	dayFmt    = "20060102"
+	daySize   = 8
+)
+
+var bE = binary.BigEndian
+
+var (
+	bktBodies = []byte("bodies") // hash -> body
+	bktCounts = []byte("counts") // hash -> refcount
+	bktObjs   = []byte("objs")   // id -> day+hash
+	bktRefs   = []byte("refs")   // day+id -> hash
+	bktMeta   = []byte("meta")
+	keyStats  = []byte("stats")
+)
+
+type Stats struct{
+	Logical  int64 // Bytes of deduplicated bodies, as seen by the clients.
+	Physical int64 // Bytes of the unique bodies actually stored.
+	Refs     int64 // References to unique bodies.
+	Unique   int64 // Unique bodies.
+}
+// Returns Logical/Physical (1 if nothing is stored).
+func (s Stats) Ratio() float64 {
+	if s.Physical==0 { return 1 }
+	return float64(s.Logical)/float64(s.Physical)
+}
+func (s *Stats) decode(b []byte) {
+	if len(b)<32 { return }
+	s.Logical  = int64(bE.Uint64(b))
+	s.Physical = int64(bE.Uint64(b[8:]))
+	s.Refs     = int64(bE.Uint64(b[16:]))
+	s.Unique   = int64(bE.Uint64(b[24:]))
+}
+func (s *Stats) encode() []byte {
+	b := make([]byte,32)
+	bE.PutUint64(b    ,uint64(s.Logical))
+	bE.PutUint64(b[8:],uint64(s.Physical))
+	bE.PutUint64(b[16:],uint64(s.Refs))
+	bE.PutUint64(b[24:],uint64(s.Unique))
+	return b
+}
+
+type DedupStore struct{
+	Store     bucketstore.BucketStore
+	Threshold int // Min. body size to deduplicate.
+	db        *bolt.DB
+}
+func Open(path string, st bucketstore.BucketStore, threshold int) (*DedupStore,error) {
+	db,err := bolt.Open(filepath.Join(path,"dedup.db"),0600,nil)
+	if err!=nil { return nil,err }
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _,b := range [][]byte{bktBodies,bktCounts,bktObjs,bktRefs,bktMeta} {
+			if _,err := tx.CreateBucketIfNotExists(b) ; err!=nil { return err }
+		}
+		return nil
+	})
+	if err!=nil { db.Close() ; return nil,err }
+	return &DedupStore{st,threshold,db},nil
+}
+
+func (d *DedupStore) Stats() (s Stats,err error) {
+	err = d.db.View(func(tx *bolt.Tx) error {
+		s.decode(tx.Bucket(bktMeta).Get(keyStats))
+		return nil
+	})
+	return
+}
+
+// Adds a reference to body. Returns bucketstore.EExists, if id is already known.
+func (d *DedupStore) ref(id []byte, hash []byte, body []byte, expire time.Time) error {
+	var day [daySize]byte
+	expire.UTC().AppendFormat(day[:0],dayFmt)
+	return d.db.Update(func(tx *bolt.Tx) error {
+		objs := tx.Bucket(bktObjs)
+		if objs.Get(id)!=nil { return bucketstore.EExists }
+		counts := tx.Bucket(bktCounts)
+		meta := tx.Bucket(bktMeta)
+		var s Stats
+		s.decode(meta.Get(keyStats))
+		
+		var cnt [8]byte
+		copy(cnt[:],counts.Get(hash))
+		n := bE.Uint64(cnt[:])
+		if n==0 {
+			if err := tx.Bucket(bktBodies).Put(hash,body) ; err!=nil { return err }
+			s.Physical += int64(len(body))
+			s.Unique++
+		}
+		bE.PutUint64(cnt[:],n+1)
+		if err := counts.Put(hash,cnt[:]) ; err!=nil { return err }
+		if err := objs.Put(id,append(day[:],hash...)) ; err!=nil { return err }
+		if err := tx.Bucket(bktRefs).Put(append(day[:],id...),hash) ; err!=nil { return err }
+		s.Logical += int64(len(body))
+		s.Refs++
+		return meta.Put(keyStats,s.encode())
+	})
+}
+
+// Drops the reference of id. Must be called within an update transaction.
+func release(tx *bolt.Tx, id []byte, s *Stats) error {
+	objs := tx.Bucket(bktObjs)
+	val := objs.Get(id)
+	if len(val)<daySize { return nil }
+	day := append([]byte(nil),val[:daySize]...)
+	hash := append([]byte(nil),val[daySize:]...)
+	if err := objs.Delete(id) ; err!=nil { return err }
+	if err := tx.Bucket(bktRefs).Delete(append(day,id...)) ; err!=nil { return err }
+	
+	bodies := tx.Bucket(bktBodies)
+	counts := tx.Bucket(bktCounts)
+	size := int64(len(bodies.Get(hash)))
+	s.Logical -= size
+	s.Refs--
+	var cnt [8]byte
+	copy(cnt[:],counts.Get(hash))
+	n := bE.Uint64(cnt[:])
+	if n>1 {
+		bE.PutUint64(cnt[:],n-1)
+		return counts.Put(hash,cnt[:])
+	}
+	s.Physical -= size
+	s.Unique--
+	if err := counts.Delete(hash) ; err!=nil { return err }
+	return bodies.Delete(hash)
+}
+func (d *DedupStore) unref(id []byte) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(bktMeta)
+		var s Stats
+		s.decode(meta.Get(keyStats))
+		if err := release(tx,id,&s) ; err!=nil { return err }
+		return meta.Put(keyStats,s.encode())
+	})
+}
+
+func (d *DedupStore) Put(id, overv, head, body []byte, expire time.Time) error {
+	if d.Threshold<=0 || len(body)<d.Threshold {
+		buf := bufferex.AllocBinary(len(body)+1)
+		defer buf.Free()
+		buf.Bytes()[0] = tagInline
+		copy(buf.Bytes()[1:],body)
+		return d.Store.Put(id,overv,head,buf.Bytes(),expire)
+	}
+	hash := sha256.Sum256(body)
+	
+	/* Reference first: if we crash in between, Expire will release it. */
+	err := d.ref(id,hash[:],body,expire)
+	if err!=nil { return err }
+	err = d.Store.Put(id,overv,head,append([]byte{tagRef},hash[:]...),expire)
+	if err!=nil { d.unref(id) }
+	return err
+}
+func (d *DedupStore) Get(id []byte, overv, head, body *bufferex.Binary) (ok bool,e error) {
+	var raw bufferex.Binary
+	var praw *bufferex.Binary
+	if body!=nil { praw = &raw }
+	ok,e = d.Store.Get(id,overv,head,praw)
+	defer raw.Free()
+	if e!=nil || !ok || body==nil { return }
+	data := raw.Bytes()
+	if len(data)==0 { *body = bufferex.Binary{} ; return }
+	switch data[0] {
+	case tagInline:
+		*body = bufferex.NewBinary(data[1:])
+		return
+	case tagRef:
+		e = d.db.View(func(tx *bolt.Tx) error {
+			b := tx.Bucket(bktBodies).Get(data[1:])
+			if b==nil { ok = false ; return nil }
+			*body = bufferex.NewBinary(b)
+			return nil
+		})
+		if e!=nil { ok = false }
+		return
+	}
+	return false,bucketstore.EDiskFailure
+}
+func (d *DedupStore) Expire(expire time.Time) error {
+	err := d.Store.Expire(expire)
+	if err!=nil { return err }
+	var day [daySize]byte
+	expire.UTC().AppendFormat(day[:0],dayFmt)
+	return d.db.Update(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(bktMeta)
+		var s Stats
+		s.decode(meta.Get(keyStats))
+		var ids [][]byte
+		cur := tx.Bucket(bktRefs).Cursor()
+		for key,_ := cur.First() ; len(key)>=daySize && string(key[:daySize])<=string(day[:]) ; key,_ = cur.Next() {
+			ids = append(ids,append([]byte(nil),key[daySize:]...))
+		}
+		for _,id := range ids {
+			if err := release(tx,id,&s) ; err!=nil { return err }
+		}
+		return meta.Put(keyStats,s.encode())
+	})
+}
+func (d *DedupStore) FreeStorage() (int64,error) { return d.Store.FreeStorage() }
+
+// Implements bucketstore.Deleter, if the underlying store does.
+func (d *DedupStore) Delete(id []byte) error {
+	dl,ok := d.Store.(bucketstore.Deleter)
+	if !ok { return bucketstore.ENotSupported }
+	if err := dl.Delete(id) ; err!=nil { return err }
+	return d.unref(id)
+}
+func (d *DedupStore) List(after []byte, targ func(id []byte, expire time.Time) bool) error {
+	if l,ok := d.Store.(bucketstore.Lister) ; ok { return l.List(after,targ) }
+	return bucketstore.ENotSupported
+}
+func (d *DedupStore) ListAge(after []byte, targ func(id []byte, stored, expire time.Time) bool) error {
+	if l,ok := d.Store.(bucketstore.AgeLister) ; ok { return l.ListAge(after,targ) }
+	return bucketstore.ENotSupported
+}
+
+/*
+Registers the backend "dedup-<kind>", which stacks a DedupStore on top of the (already
+registered) backend kind, eg. "dedup-dayfile".
+*/
+func Register(kind string, threshold int) {
+	loader := bucketstore.Backends[kind]
+	if loader==nil { return }
+	bucketstore.Backends["dedup-"+kind] = func(path string, cfg *bucketstore.Config) (bucketstore.BucketStore,error) {
+		st,err := loader(path,cfg)
+		if err!=nil { return nil,err }
+		return Open(path,st,threshold)
+	}
+	bucketstore.Formats["dedup-"+kind] = bucketstore.Formats[kind]
+}
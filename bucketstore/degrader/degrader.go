@@ -54,6 +54,10 @@ func (d *Degrader) Success() {
 	d.reset()
 }
 
+/*
+Records a failure. After more than Dmd.MaxErrors failures, the resource is damaged for
+Dmd.RetryAfter (see Damaged).
+*/
 func (d *Degrader) Fail() {
 	if d.Dmd==nil { return }
 	d.mtx.Lock(); defer d.mtx.Unlock()
@@ -65,8 +69,9 @@ func (d *Degrader) Fail() {
 	
 	d.damaged = true
 	
-	time.Now().Add(d.Dmd.RetryAfter)
+	d.waitUntil = time.Now().Add(d.Dmd.RetryAfter)
 }
+// Marks the resource as damaged for Dmd.RetryAfter.
 func (d *Degrader) ForceFail() {
 	if d.Dmd==nil { return }
 	d.mtx.Lock(); defer d.mtx.Unlock()
@@ -75,7 +80,7 @@ func (d *Degrader) ForceFail() {
 	
 	d.damaged = true
 	
-	time.Now().Add(d.Dmd.RetryAfter)
+	d.waitUntil = time.Now().Add(d.Dmd.RetryAfter)
 }
 
 func (d *Degrader) Damaged() bool {
@@ -91,3 +96,9 @@ func (d *Degrader) Damaged() bool {
 	return true
 }
 
+
+// Clears the damaged state, eg. after an operator fixed the resource.
+func (d *Degrader) Reset() {
+	d.mtx.Lock(); defer d.mtx.Unlock()
+	d.reset()
+}
@@ -0,0 +1,191 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+/*
+Operator-triggered draining of a bucket.
+
+A Drainer puts the bucket into draining mode, copies all live articles (along with their
+expiry) into other buckets through Submit, points the BucketDatabase ID mappings
+to the new location and finally retires the bucket UUID.
+The progress is checkpointed into a file, so an interrupted drain can be resumed.
+*/
+package drain
+
+import "errors"
+import "io/ioutil"
+import "os"
+import "time"
+import "github.com/vmihailenco/msgpack"
+import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore"
+import "github.com/maxymania/fastnntp-polyglot-labs/bufferex"
+import "github.com/maxymania/fastnntp-polyglot-labs/articlewrap"
+import "github.com/maxymania/fastnntp-polyglot-labs/guido"
+
+var ESelfSubmit = errors.New("Target placed an article into the drained bucket")
+var EIncomplete = errors.New("Some articles could not be moved")
+var ENoMapping = errors.New("Drainer.Mapping is required, moved articles would become unreachable")
+
+// The cluster interface. Implemented by *cluster.Membered.
+type Cluster interface{
+	SetMode(uuid string, mode bucketstore.Mode) error
+	Retire(uuid string)
+}
+
+type Progress struct{
+	_msgpack struct{} `msgpack:",asArray"`
+	Moved   int64  // Articles copied into other buckets.
+	Expired int64  // Articles skipped, because they are expired anyway.
+	Failed  int64  // Articles, that could not be moved.
+	Bytes   int64  // Bytes copied.
+	Last    []byte // The ID of the last processed article.
+	Done    bool
+}
+
+type idQuery interface{
+	QueryIDMapping(msgid []byte) (bucket bufferex.Binary,err error)
+}
+
+type Drainer struct{
+	Source  bucketstore.BucketStore // Must implement bucketstore.Lister.
+	Uuid    string
+	Target  bucketstore.OverStore   // Where the articles go. Must not place them into Source.
+	Mapping articlewrap.IDMappingUpdater // Required. If it is a BucketDatabase, moved articles are recognized on retries.
+	
+	Cluster Cluster // Optional.
+	Path    string  // Optional. If set, the bucket directory is marked as retired, once done.
+	
+	Checkpoint      string // Optional. The checkpoint file.
+	CheckpointEvery int    // Default: 100
+	
+	Report func(p *Progress) // Optional. Called after every checkpoint.
+}
+
+func (d *Drainer) load(p *Progress) error {
+	if d.Checkpoint=="" { return nil }
+	data,err := ioutil.ReadFile(d.Checkpoint)
+	if os.IsNotExist(err) { return nil }
+	if err!=nil { return err }
+	return msgpack.Unmarshal(data,p)
+}
+func (d *Drainer) save(p *Progress) error {
+	if d.Report!=nil { d.Report(p) }
+	if d.Checkpoint=="" { return nil }
+	data,err := msgpack.Marshal(p)
+	if err!=nil { return err }
+	tmp := d.Checkpoint+".tmp"
+	err = ioutil.WriteFile(tmp,data,0600)
+	if err!=nil { return err }
+	return os.Rename(tmp,d.Checkpoint)
+}
+
+func (d *Drainer) moved(id []byte) bool {
+	q,ok := d.Mapping.(idQuery)
+	if !ok { return false }
+	bucket,err := q.QueryIDMapping(id)
+	defer bucket.Free()
+	return err==nil && len(bucket.Bytes())>0 && string(bucket.Bytes())!=d.Uuid
+}
+func (d *Drainer) move(id []byte, expire time.Time, p *Progress) error {
+	var overv,head,body bufferex.Binary
+	if d.moved(id) { return nil }
+	
+	ok,err := d.Source.Get(id,&overv,&head,&body)
+	defer overv.Free()
+	defer head.Free()
+	defer body.Free()
+	if err!=nil { return err }
+	if !ok { p.Failed++ ; return nil }
+	
+	bucket,err := d.Target.Submit(id,overv.Bytes(),head.Bytes(),body.Bytes(),expire)
+	defer bucket.Free()
+	
+	/* If the article has been copied in an earlier, interrupted run, just update the mapping. */
+	if err==bucketstore.EExists && len(bucket.Bytes())>0 { err = nil }
+	if err!=nil { p.Failed++ ; return nil }
+	if string(bucket.Bytes())==d.Uuid { return ESelfSubmit }
+	
+	err = d.Mapping.UpdateIDMapping(id,bucket.Bytes())
+	if err!=nil { return err }
+	p.Moved++
+	p.Bytes += int64(len(overv.Bytes())+len(head.Bytes())+len(body.Bytes()))
+	return nil
+}
+
+/*
+Runs (or resumes) the drain. On error, the progress up to the last checkpoint is
+kept and Run can be called again.
+*/
+func (d *Drainer) Run() (*Progress,error) {
+	if d.Mapping==nil { return nil,ENoMapping }
+	p := new(Progress)
+	if err := d.load(p) ; err!=nil { return nil,err }
+	if p.Done { return p,nil }
+	
+	lst,ok := d.Source.(bucketstore.Lister)
+	if !ok { return nil,bucketstore.ENotSupported }
+	
+	if d.Cluster!=nil {
+		if err := d.Cluster.SetMode(d.Uuid,bucketstore.ModeDraining) ; err!=nil { return nil,err }
+	}
+	
+	every := d.CheckpointEvery
+	if every<=0 { every = 100 }
+	
+	var ferr error
+	now := time.Now().UTC()
+	n := 0
+	err := lst.List(p.Last,func(id []byte, expire time.Time) bool {
+		if expire.Before(now) {
+			p.Expired++
+		} else {
+			ferr = d.move(id,expire,p)
+			if ferr!=nil { return false }
+		}
+		p.Last = append(p.Last[:0],id...)
+		n++
+		if (n%every)==0 { ferr = d.save(p) }
+		return ferr==nil
+	})
+	if err==nil { err = ferr }
+	if err!=nil { d.save(p) ; return p,err }
+	
+	/* Never retire a bucket, that still holds articles. The next run starts over. */
+	if p.Failed>0 {
+		q := *p
+		q.Last = nil
+		q.Failed = 0
+		d.save(&q)
+		return p,EIncomplete
+	}
+	
+	p.Done = true
+	err = d.save(p)
+	if err!=nil { return p,err }
+	
+	if d.Path!="" {
+		err = guido.Retire(d.Path)
+		if err!=nil { return p,err }
+	}
+	if d.Cluster!=nil { d.Cluster.Retire(d.Uuid) }
+	return p,nil
+}
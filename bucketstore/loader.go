@@ -25,19 +25,55 @@ package bucketstore
 
 import "github.com/maxymania/fastnntp-polyglot-labs/guido"
 import "fmt"
+import "reflect"
 
 type Bucket struct{
 	Store BucketStore
 	Uuid  string
+	Path  string
+	Mode  Mode
+	Ident *guido.Config
 }
 
 func OpenStore(kind, path string, cfg *Config) (*Bucket,error){
 	loader,ok := Backends[kind]
 	if !ok { return nil,fmt.Errorf("No such backend %q",kind) }
-	uid,err := guido.GetUID(path)
+	id,err := checkIdentity(kind,path,cfg)
+	if err!=nil { return nil,err }
+	ms,err := guido.GetMode(path)
+	if err!=nil { return nil,err }
+	mode,err := ParseMode(ms)
 	if err!=nil { return nil,err }
 	st,err := loader(path,cfg)
 	if err!=nil { return nil,err }
-	return &Bucket{st,uid.String()},nil
+	return &Bucket{st,id.Uuid,path,mode,id},nil
+}
+func checkIdentity(kind, path string, cfg *Config) (*guido.Config,error) {
+	format := Formats[kind]
+	id,err := guido.GetIdentity(path,kind,format,cfg.MaxSpace)
+	if err!=nil { return nil,err }
+	if id.Kind!=kind { return nil,fmt.Errorf("Bucket %q is of kind %q, not %q",path,id.Kind,kind) }
+	if id.Format>format { return nil,fmt.Errorf("Bucket %q has format %d, backend %q supports %d",path,id.Format,kind,format) }
+	dirty := false
+	if id.Capacity!=cfg.MaxSpace {
+		if !cfg.Resize { return nil,fmt.Errorf("Bucket %q has a capacity of %d, not %d",path,id.Capacity,cfg.MaxSpace) }
+		id.Capacity = cfg.MaxSpace
+		dirty = true
+	}
+	if cfg.Labels!=nil && !reflect.DeepEqual(id.Labels,cfg.Labels) {
+		id.Labels = cfg.Labels
+		dirty = true
+	}
+	if dirty { err = guido.PutIdentity(path,id) }
+	return id,err
+}
+
+// Changes the mode of the bucket and persists it next to "guid.cfg".
+func (b *Bucket) SetMode(m Mode) error {
+	if b.Path!="" {
+		if err := guido.SetMode(b.Path,m.String()) ; err!=nil { return err }
+	}
+	b.Mode = m
+	return nil
 }
 
@@ -26,6 +26,7 @@ package mock
 import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore"
 import "github.com/maxymania/fastnntp-polyglot-labs/bufferex"
 import "time"
+import "io"
 
 type Buckets map[string]*bucketstore.Bucket
 
@@ -33,7 +34,10 @@ func (b Buckets) Add(bu *bucketstore.Bucket) {
 	b[bu.Uuid] = bu
 }
 func (b Buckets) OverPut(bucket []byte, id, overv, head, body []byte, expire time.Time) error {
-	if v := b[string(bucket)] ; v!=nil { return v.Store.Put(id,overv,head,body,expire) }
+	if v := b[string(bucket)] ; v!=nil {
+		if !v.Mode.Writable() { return bucketstore.EReadOnly }
+		return v.Store.Put(id,overv,head,body,expire)
+	}
 	return bucketstore.ENoBucket
 }
 func (b Buckets) OverGet(bucket []byte, id []byte, overv, head, body *bufferex.Binary) (ok bool,e error) {
@@ -48,16 +52,68 @@ func (b Buckets) OverFreeStorage(bucket []byte) (int64,error) {
 	if v := b[string(bucket)] ; v!=nil { return v.Store.FreeStorage() }
 	return 0,bucketstore.ENoBucket
 }
+func (b Buckets) OverDelete(bucket []byte, id []byte) error {
+	v := b[string(bucket)]
+	if v==nil { return bucketstore.ENoBucket }
+	if d,ok := v.Store.(bucketstore.Deleter) ; ok { return d.Delete(id) }
+	return bucketstore.ENotSupported
+}
+func (b Buckets) OverGetReader(bucket []byte, id []byte, overv, head *bufferex.Binary) (body io.ReadCloser, size int64, ok bool, e error) {
+	if v := b[string(bucket)] ; v!=nil { return bucketstore.GetReader(v.Store,id,overv,head) }
+	return nil,0,false,bucketstore.ENoBucket
+}
+func (b Buckets) OverGetRange(bucket []byte, id []byte, off, length int64) (body io.ReadCloser, size int64, ok bool, e error) {
+	if v := b[string(bucket)] ; v!=nil { return bucketstore.GetRange(v.Store,id,off,length) }
+	return nil,0,false,bucketstore.ENoBucket
+}
+func (b Buckets) OverPutReader(bucket []byte, id, overv, head []byte, body io.Reader, size int64, expire time.Time) error {
+	if v := b[string(bucket)] ; v!=nil {
+		if !v.Mode.Writable() { return bucketstore.EReadOnly }
+		return bucketstore.PutReader(v.Store,id,overv,head,body,size,expire)
+	}
+	return bucketstore.ENoBucket
+}
+func (b Buckets) OverPutMany(bucket []byte, items []bucketstore.Item) []error {
+	errs := make([]error,len(items))
+	v := b[string(bucket)]
+	var e error
+	switch {
+	case v==nil: e = bucketstore.ENoBucket
+	case !v.Mode.Writable(): e = bucketstore.EReadOnly
+	default: return bucketstore.PutMany(v.Store,items)
+	}
+	for i := range errs { errs[i] = e }
+	return errs
+}
+func (b Buckets) OverScan(bucket []byte, token []byte, filter bucketstore.ScanFilter, limit int) (entries []bucketstore.ScanEntry, next []byte, e error) {
+	if v := b[string(bucket)] ; v!=nil { return bucketstore.Scan(v.Store,token,filter,limit) }
+	return nil,nil,bucketstore.ENoBucket
+}
+func (b Buckets) OverStat(bucket []byte, id []byte) (st bucketstore.ObjectStat, ok bool, e error) {
+	if v := b[string(bucket)] ; v!=nil { return bucketstore.Stat(v.Store,id) }
+	e = bucketstore.ENoBucket
+	return
+}
 func (b Buckets) Submit(id, overv, head, body []byte, expire time.Time) (bucket bufferex.Binary,err error) {
+	return b.SubmitClass("",id,overv,head,body,expire)
+}
+func class(bu *bucketstore.Bucket) string {
+	if bu.Ident==nil { return "" }
+	return bu.Ident.Labels[bucketstore.ClassLabel]
+}
+// Implements bucketstore.ClassSubmitter. There is no fallback class.
+func (b Buckets) SubmitClass(cl string, id, overv, head, body []byte, expire time.Time) (bucket bufferex.Binary,err error) {
 	err = bucketstore.ENoBucket
 	size := int64(len(id)+len(overv)+len(head)+len(body))
 	var free int64
 	for _,bkt := range b {
+		if !bkt.Mode.Writable() { continue }
+		if cl!="" && class(bkt)!=cl { continue }
 		if free,err = bkt.Store.FreeStorage(); err==nil && free<=size {
 			continue
 		}
 		err = bkt.Store.Put(id,overv,head,body,expire)
-		if err==nil { bucket = bufferex.NewBinaryStr(bkt.Uuid) }
+		if err==nil || err==bucketstore.EExists { bucket = bufferex.NewBinaryStr(bkt.Uuid) }
 		return
 	}
 	return
@@ -0,0 +1,80 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package bucketstore
+
+import "io"
+import "io/ioutil"
+
+/*
+Optional interface. Reads length bytes of the body, starting at offset off.
+A negative length reads up to the end of the body. size is the total size of the body.
+*/
+type RangeGetter interface{
+	GetRange(id []byte, off, length int64) (body io.ReadCloser, size int64, ok bool, e error)
+}
+
+// Optional interface of an OverStore. See RangeGetter.
+type OverRangeGetter interface{
+	OverGetRange(bucket []byte, id []byte, off, length int64) (body io.ReadCloser, size int64, ok bool, e error)
+}
+
+/*
+Clips the range (off,length) to a body of size bytes.
+Returns ERange, if off lies beyond the end of the body.
+*/
+func ClipRange(off, length, size int64) (int64,int64,error) {
+	if off<0 || off>size { return 0,0,ERange }
+	if length<0 || off+length>size { length = size-off }
+	return off,length,nil
+}
+
+func skipRange(body io.ReadCloser, size, off, length int64) (io.ReadCloser, int64, bool, error) {
+	off,length,e := ClipRange(off,length,size)
+	if e!=nil { body.Close() ; return nil,0,false,e }
+	if _,e = io.CopyN(ioutil.Discard,body,off) ; e!=nil { body.Close() ; return nil,0,false,e }
+	return streamCloser{io.LimitReader(body,length),body},size,true,nil
+}
+
+type streamCloser struct{
+	io.Reader
+	c io.Closer
+}
+func (s streamCloser) Close() error { return s.c.Close() }
+
+// Uses RangeGetter, if implemented by s, GetReader otherwise.
+func GetRange(s BucketStore, id []byte, off, length int64) (body io.ReadCloser, size int64, ok bool, e error) {
+	if rg,isRg := s.(RangeGetter) ; isRg { return rg.GetRange(id,off,length) }
+	body,size,ok,e = GetReader(s,id,nil,nil)
+	if e!=nil || !ok { return }
+	return skipRange(body,size,off,length)
+}
+
+// Uses OverRangeGetter, if implemented by s, OverGetReader otherwise.
+func OverGetRange(s OverStore, bucket []byte, id []byte, off, length int64) (body io.ReadCloser, size int64, ok bool, e error) {
+	if rg,isRg := s.(OverRangeGetter) ; isRg { return rg.OverGetRange(bucket,id,off,length) }
+	body,size,ok,e = OverGetReader(s,bucket,id,nil,nil)
+	if e!=nil || !ok { return }
+	return skipRange(body,size,off,length)
+}
@@ -0,0 +1,157 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package remote
+
+import "crypto/subtle"
+import "encoding/json"
+import "sort"
+import "sync/atomic"
+import "time"
+import "github.com/valyala/fasthttp"
+import "github.com/maxymania/fastnntp-polyglot-labs/binarix"
+
+/*
+Cluster information for the admin API. Implemented by *cluster.Membered.
+*/
+type ClusterInfo interface{
+	// Returns the name of the node owning the bucket, "" for local buckets.
+	BucketOwner(uuid string) string
+	// Returns a JSON-serializable view of the cluster members.
+	AdminView() interface{}
+}
+
+type BucketInfo struct{
+	Uuid     string `json:"uuid"`
+	Local    bool   `json:"local"`
+	Owner    string `json:"owner,omitempty"`
+	Free     int64  `json:"free"` // -1 if unknown.
+	Degraded bool   `json:"degraded"`
+	Mode     string `json:"mode"`
+	Class    string `json:"class,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+func (b *BucketRouter) BucketInfos() []BucketInfo {
+	b.remlock.Lock()
+	infos := make([]BucketInfo,0,len(b.uuids))
+	locals := make(map[string]*BucketShare,len(b.locals))
+	remotes := make(map[string]*Client,len(b.remotes))
+	for _,uuid := range b.uuids {
+		infos = append(infos,BucketInfo{Uuid:uuid,Mode:b.modes[uuid].String(),Class:b.classes[uuid]})
+		if lc := b.locals[uuid] ; lc!=nil { locals[uuid] = lc }
+		if rc := b.remotes[uuid] ; rc!=nil { remotes[uuid] = rc }
+	}
+	b.remlock.Unlock()
+	
+	/* Querying remote buckets involves network I/O, so it is done without holding the lock. */
+	for i := range infos {
+		bi := &infos[i]
+		if b.Cluster!=nil { bi.Owner = b.Cluster.BucketOwner(bi.Uuid) }
+		if lc := locals[bi.Uuid] ; lc!=nil {
+			bi.Local = true
+			bi.Free = atomic.LoadInt64(&lc.spcLeft)
+			bi.Degraded = lc.degr.Damaged()
+		} else if rc := remotes[bi.Uuid] ; rc!=nil {
+			bi.Degraded = rc.degr.Damaged()
+			free,err := rc.FreeStorage()
+			bi.Free = free
+			if err!=nil { bi.Free = -1 ; bi.Error = err.Error() }
+		}
+	}
+	sort.Slice(infos,func(i,j int) bool { return infos[i].Uuid<infos[j].Uuid })
+	return infos
+}
+
+func writeJson(ctx *fasthttp.RequestCtx, v interface{}) {
+	data,err := json.Marshal(v)
+	if err!=nil { ctx.Error(err.Error(),fasthttp.StatusInternalServerError) ; return }
+	ctx.SetContentType("application/json")
+	ctx.Write(data)
+}
+
+func (b *BucketRouter) authorized(ctx *fasthttp.RequestCtx) bool {
+	if b.AdminToken=="" { return false }
+	tok := ctx.Request.Header.Peek("X-Admin-Token")
+	return subtle.ConstantTimeCompare(tok,[]byte(b.AdminToken))==1
+}
+
+/*
+The admin API:
+
+	GET  /api.admin/buckets                 - JSON list of BucketInfo
+	GET  /api.admin/members                 - JSON view of the cluster members
+	POST /api.admin/expire/<bucket>/<date>  - Expires the bucket (date in URLDate format)
+	POST /api.admin/reset/<bucket>          - Resets the degrader of the bucket
+
+The POST operations require the X-Admin-Token header to match AdminToken.
+If AdminToken is set, the GET operations require it as well.
+*/
+func (b *BucketRouter) apiAdmin(path binarix.Iterator, ctx *fasthttp.RequestCtx) {
+	op := string(path.Split('/'))
+	if ctx.IsGet() {
+		if b.AdminToken!="" && !b.authorized(ctx) { ctx.Error("Forbidden",fasthttp.StatusForbidden) ; return }
+		switch op {
+		case "buckets":
+			writeJson(ctx,b.BucketInfos())
+			return
+		case "members":
+			if b.Cluster==nil { writeJson(ctx,nil) ; return }
+			writeJson(ctx,b.Cluster.AdminView())
+			return
+		}
+		ctx.Error("Not found",fasthttp.StatusNotFound)
+		return
+	}
+	if !ctx.IsPost() { ctx.Error("Method not allowed",fasthttp.StatusMethodNotAllowed) ; return }
+	if !b.authorized(ctx) { ctx.Error("Forbidden",fasthttp.StatusForbidden) ; return }
+	
+	uuid := string(path.Split('/'))
+	b.remlock.Lock()
+	lc := b.locals[uuid]
+	rc := b.remotes[uuid]
+	b.remlock.Unlock()
+	if lc==nil && rc==nil { ctx.Error("No such bucket",fasthttp.StatusNotFound) ; return }
+	
+	switch op {
+	case "expire":
+		expire,err := time.ParseInLocation(URLDate,string(path.Split('/')),time.UTC)
+		if err!=nil { ctx.Error("Bad Request",fasthttp.StatusBadRequest) ; return }
+		if lc!=nil {
+			err = lc.Store.Expire(expire)
+			lc.Wakeup()
+		} else {
+			err = rc.Expire(expire)
+		}
+		if err!=nil { ctx.Error(err.Error(),fasthttp.StatusInternalServerError) ; return }
+	case "reset":
+		if lc!=nil {
+			lc.degr.Reset()
+		} else {
+			rc.degr.Reset()
+		}
+	default:
+		ctx.Error("Not found",fasthttp.StatusNotFound)
+		return
+	}
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+}
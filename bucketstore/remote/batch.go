@@ -0,0 +1,147 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package remote
+
+import "bytes"
+import "io"
+import "fmt"
+import "time"
+import "sync/atomic"
+import "github.com/valyala/fasthttp"
+import "github.com/vmihailenco/msgpack"
+import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore"
+import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore/degrader"
+
+/*
+Multi-record PUT: PUT /<bucket>/-
+
+The request body is a sequence of msgpack encoded batchRecord frames. The response (207) is a
+msgpack encoded array, holding the status code of each record, as it would have been returned
+by a single PUT.
+*/
+type batchRecord struct{
+	_msgpack struct{} `msgpack:",asArray"`
+	Id, Over, Head, Body []byte
+	Expire int64 // Unix time
+}
+
+// Maps an error returned by Put to the status code of a PUT request. Inverse of putError.
+func putStatus(err error) int {
+	switch err {
+	case nil:                           return fasthttp.StatusCreated
+	case bucketstore.EBadRequest:       return fasthttp.StatusBadRequest
+	case bucketstore.EExists:           return fasthttp.StatusConflict
+	case bucketstore.EOutOfStorage:     return fasthttp.StatusInsufficientStorage
+	case bucketstore.ENoBucket:         return fasthttp.StatusNotFound
+	case bucketstore.ETemporaryFailure: return statusTemporaryFailure
+	case bucketstore.EReadOnly:         return statusReadOnly
+	}
+	return statusDiskFailure
+}
+
+func (b *BucketShare) putMany(ctx *fasthttp.RequestCtx) {
+	if !b.Mode().Writable() {
+		b.m.putRO.Inc()
+		ctx.Error("Bucket is "+b.Mode().String(),statusReadOnly)
+		return
+	}
+	var items []bucketstore.Item
+	var total int64
+	dec := msgpack.NewDecoder(bytes.NewReader(ctx.Request.Body()))
+	for {
+		var rec batchRecord
+		err := dec.Decode(&rec)
+		if err==io.EOF { break }
+		if err!=nil { ctx.Error("Bad Request",fasthttp.StatusBadRequest) ; return }
+		items = append(items,bucketstore.Item{Id:rec.Id,Over:rec.Over,Head:rec.Head,Body:rec.Body,Expire:time.Unix(rec.Expire,0).UTC()})
+		total += int64(len(rec.Over)+len(rec.Head)+len(rec.Body))
+	}
+	lng := atomic.LoadInt64(&b.spcLeft)
+	if lng<total {
+		b.m.putFull.Inc()
+		ctx.Error("Out of Storage Space",fasthttp.StatusInsufficientStorage)
+		return
+	}
+	
+	errs := bucketstore.PutMany(b.Store,items)
+	codes := make([]int,len(errs))
+	for i,err := range errs {
+		codes[i] = putStatus(err)
+		switch err {
+		case nil:
+			b.m.putOk.Inc()
+			b.m.putBytes.Add(uint64(len(items[i].Over)+len(items[i].Head)+len(items[i].Body)))
+		case bucketstore.EExists: b.m.putExists.Inc()
+		case bucketstore.EOutOfStorage: b.m.putFull.Inc()
+		default: b.m.putErr.Inc()
+		}
+	}
+	
+	b.Wakeup() // Let the background process do it's job
+	
+	buf,_ := msgpack.Marshal(codes)
+	ctx.SetStatusCode(fasthttp.StatusMultiStatus)
+	ctx.Write(buf)
+}
+
+// Implements bucketstore.BatchPutter. All items are sent in one request.
+func (c *Client) PutMany(items []bucketstore.Item) []error {
+	errs := make([]error,len(items))
+	fail := func(e error) []error {
+		for i := range errs { errs[i] = e }
+		return errs
+	}
+	
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	
+	req.Header.SetMethod("PUT")
+	req.SetRequestURI(fmt.Sprintf("/%s/-",c.uuid))
+	
+	enc := msgpack.NewEncoder(req.BodyWriter())
+	for _,it := range items {
+		enc.Encode(&batchRecord{Id:it.Id,Over:it.Over,Head:it.Head,Body:it.Body,Expire:it.Expire.Unix()})
+	}
+	
+	required(req)
+	err := c.client.DoDeadline(req,resp,time.Now().Add(time.Second*10))
+	
+	if err!=nil { return fail(err) }
+	
+	fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+	
+	if resp.StatusCode()!=fasthttp.StatusMultiStatus { return fail(putError(resp.StatusCode())) }
+	
+	var codes []int
+	if msgpack.Unmarshal(resp.Body(),&codes)!=nil || len(codes)!=len(items) { return fail(bucketstore.EBadRequest) }
+	for i,code := range codes { errs[i] = putError(code) }
+	return errs
+}
+
+func (m *MultiClient) OverPutMany(bucket []byte, items []bucketstore.Item) []error {
+	c := Client{m.client,bucket,degrader.Degrader{}}
+	return c.PutMany(items)
+}
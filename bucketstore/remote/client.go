@@ -87,13 +87,18 @@ func (c *Client) Put(id, overv, head, body []byte, expire time.Time) error {
 	fasthttp.ReleaseRequest(req)
 	defer fasthttp.ReleaseResponse(resp)
 	
-	switch resp.StatusCode() {
+	return putError(resp.StatusCode())
+}
+// Maps the status code of a PUT request to an error.
+func putError(code int) error {
+	switch code {
 	case fasthttp.StatusBadRequest:          return bucketstore.EBadRequest
 	case fasthttp.StatusCreated:             return nil
 	case fasthttp.StatusConflict:            return bucketstore.EExists
 	case fasthttp.StatusInsufficientStorage: return bucketstore.EOutOfStorage
 	case fasthttp.StatusNotFound:            return bucketstore.ENoBucket
 	case statusTemporaryFailure:             return bucketstore.ETemporaryFailure
+	case statusReadOnly:                     return bucketstore.EReadOnly
 	default:                                 return bucketstore.EDiskFailure
 	}
 	
@@ -163,6 +168,30 @@ func (c *Client) Expire(expire time.Time) error {
 	
 	return nil
 }
+// Implements bucketstore.Deleter.
+func (c *Client) Delete(id []byte) error {
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	
+	req.Header.SetMethod("DELETE")
+	c.setUrl(req,id,[]byte("-"))
+	
+	required(req)
+	err := c.client.DoDeadline(req,resp,time.Now().Add(time.Second))
+	
+	if err!=nil { return err }
+	
+	fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+	
+	switch resp.StatusCode() {
+	case fasthttp.StatusNoContent:       return nil
+	case fasthttp.StatusNotFound:        return bucketstore.ENoBucket
+	case fasthttp.StatusNotImplemented:  return bucketstore.ENotSupported
+	case statusTemporaryFailure:         return bucketstore.ETemporaryFailure
+	}
+	return bucketstore.EDiskFailure
+}
 func (c *Client) FreeStorage() (int64,error) {
 	req := fasthttp.AcquireRequest()
 	resp := fasthttp.AcquireResponse()
@@ -191,6 +220,11 @@ func NewMultiClient(c HttpClient) *MultiClient {
 }
 
 func (m *MultiClient) Submit(id, overv, head, body []byte, expire time.Time) (bucket bufferex.Binary,err error) {
+	return m.SubmitClass("",id,overv,head,body,expire)
+}
+
+// Implements bucketstore.ClassSubmitter. The router falls back to its Fallback class, if needed.
+func (m *MultiClient) SubmitClass(class string, id, overv, head, body []byte, expire time.Time) (bucket bufferex.Binary,err error) {
 	const prefix = "/api.submit/"
 	var numbuf [16]byte
 	var buf [32]byte
@@ -205,6 +239,7 @@ func (m *MultiClient) Submit(id, overv, head, body []byte, expire time.Time) (bu
 	req.Header.SetBytesV("X-Over",binarix.Itoa(int64(len(overv)),numbuf[:0]))
 	req.Header.SetBytesV("X-Head",binarix.Itoa(int64(len(head )),numbuf[:0]))
 	req.Header.SetBytesV("X-Body",binarix.Itoa(int64(len(body )),numbuf[:0]))
+	if class!="" { req.Header.Set("X-Class",class) }
 	
 	req.AppendBody(overv)
 	req.AppendBody(head)
@@ -225,11 +260,13 @@ func (m *MultiClient) Submit(id, overv, head, body []byte, expire time.Time) (bu
 	case fasthttp.StatusInsufficientStorage: err = bucketstore.EOutOfStorage
 	case fasthttp.StatusNotFound:            err = bucketstore.ENoBucket
 	case statusTemporaryFailure:             err = bucketstore.ETemporaryFailure
+	case statusReadOnly:                     err = bucketstore.EReadOnly
 	default:                                 err = bucketstore.EDiskFailure
 	}
 	
-	if err==nil {
-		bucket = bufferex.NewBinary(resp.Header.Peek("X-Bucket"))
+	/* On Conflict, the router tells us, which bucket already holds the object. */
+	if err==nil || err==bucketstore.EExists {
+		if xb := resp.Header.Peek("X-Bucket"); len(xb)>0 { bucket = bufferex.NewBinary(xb) }
 	}
 	
 	return
@@ -246,6 +283,10 @@ func (m *MultiClient) OverExpire(bucket []byte, expire time.Time) error {
 	c := Client{m.client,bucket,degrader.Degrader{}}
 	return c.Expire(expire)
 }
+func (m *MultiClient) OverDelete(bucket []byte, id []byte) error {
+	c := Client{m.client,bucket,degrader.Degrader{}}
+	return c.Delete(id)
+}
 func (m *MultiClient) OverFreeStorage(bucket []byte) (int64,error) {
 	c := Client{m.client,bucket,degrader.Degrader{}}
 	return c.FreeStorage()
@@ -0,0 +1,113 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package remote
+
+import "github.com/maxymania/fastnntp-polyglot-labs/metrics"
+import "sync/atomic"
+
+const (
+	mnRequests = "bucket_requests_total"
+	mnBytes    = "bucket_bytes_total"
+	mnSpace    = "bucket_space_left_bytes"
+	mnDegraded = "bucket_degraded"
+	mnPending  = "bucket_pending_requests"
+)
+
+var mSubmit = [...]*metrics.Counter{
+	metrics.Default.Counter("router_submit_total","Articles submitted through api.submit.","result","created"),
+	metrics.Default.Counter("router_submit_total","Articles submitted through api.submit.","result","exists"),
+	metrics.Default.Counter("router_submit_total","Articles submitted through api.submit.","result","full"),
+}
+const (
+	submitCreated = iota
+	submitExists
+	submitFull
+)
+
+var requestLabels = [...][2]string{
+	{"get","ok"},{"get","miss"},{"get","error"},
+	{"put","ok"},{"put","exists"},{"put","full"},{"put","readonly"},{"put","error"},
+}
+
+// Per-bucket counters of a BucketShare.
+type shareMetrics struct{
+	getOk, getMiss, getErr *metrics.Counter
+	putOk, putExists, putFull, putRO, putErr *metrics.Counter
+	getBytes, putBytes *metrics.Counter
+}
+func newShareMetrics(uuid string) *shareMetrics {
+	var c [len(requestLabels)+2]*metrics.Counter
+	for i := range c { c[i] = new(metrics.Counter) }
+	if uuid!="" {
+		for i,l := range requestLabels {
+			c[i] = metrics.Default.Counter(mnRequests,"Requests served by the local buckets.","bucket",uuid,"op",l[0],"result",l[1])
+		}
+		c[len(requestLabels)  ] = metrics.Default.Counter(mnBytes,"Bytes read and written by the local buckets.","bucket",uuid,"op","get")
+		c[len(requestLabels)+1] = metrics.Default.Counter(mnBytes,"Bytes read and written by the local buckets.","bucket",uuid,"op","put")
+	}
+	return &shareMetrics{c[0],c[1],c[2],c[3],c[4],c[5],c[6],c[7],c[8],c[9]}
+}
+
+func b2f(b bool) float64 {
+	if b { return 1 }
+	return 0
+}
+
+// Registers the metrics of a local bucket.
+func registerLocal(uuid string, bush *BucketShare) {
+	bush.m = newShareMetrics(uuid)
+	metrics.Default.GaugeFunc(mnSpace,"Free storage of the local buckets.",func() float64 {
+		return float64(atomic.LoadInt64(&bush.spcLeft))
+	},"bucket",uuid)
+	metrics.Default.GaugeFunc(mnDegraded,"1 if the bucket had failures recently.",func() float64 {
+		return b2f(bush.degr.Damaged())
+	},"bucket",uuid)
+}
+
+// Implemented by transports, that multiplex requests (eg. oohttp.Client).
+type pendingCounter interface{
+	PendingRequests() int
+}
+
+// Registers the metrics of a remote bucket.
+func registerRemote(uuid string, cli *Client) {
+	metrics.Default.GaugeFunc(mnDegraded,"1 if the bucket had failures recently.",func() float64 {
+		return b2f(cli.degr.Damaged())
+	},"bucket",uuid)
+	if pc,ok := cli.client.(pendingCounter) ; ok {
+		metrics.Default.GaugeFunc(mnPending,"Requests in flight on the connection to the node of a remote bucket.",func() float64 {
+			return float64(pc.PendingRequests())
+		},"bucket",uuid)
+	}
+}
+
+func unregisterBucket(uuid string) {
+	for _,l := range requestLabels {
+		metrics.Default.Unregister(mnRequests,"bucket",uuid,"op",l[0],"result",l[1])
+	}
+	metrics.Default.Unregister(mnBytes,"bucket",uuid,"op","get")
+	metrics.Default.Unregister(mnBytes,"bucket",uuid,"op","put")
+	metrics.Default.Unregister(mnSpace,"bucket",uuid)
+	metrics.Default.Unregister(mnDegraded,"bucket",uuid)
+	metrics.Default.Unregister(mnPending,"bucket",uuid)
+}
@@ -0,0 +1,118 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package remote
+
+import "bytes"
+import "io"
+import "time"
+import "strconv"
+import "strings"
+import "github.com/valyala/fasthttp"
+import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore"
+import "github.com/maxymania/fastnntp-polyglot-labs/binarix"
+import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore/degrader"
+
+/*
+Parses a "Range: bytes=first-last" header. The last byte is optional.
+Suffix ranges ("bytes=-n") and multiple ranges are not supported.
+*/
+func parseRange(rng []byte) (off, length int64, ok bool) {
+	s := string(rng)
+	if !strings.HasPrefix(s,"bytes=") { return }
+	s = s[len("bytes="):]
+	i := strings.IndexByte(s,'-')
+	if i<1 { return }
+	off,err := strconv.ParseInt(s[:i],10,64)
+	if err!=nil || off<0 { return }
+	if i+1==len(s) { return off,-1,true }
+	last,err := strconv.ParseInt(s[i+1:],10,64)
+	if err!=nil || last<off { return }
+	return off,last+1-off,true
+}
+
+/*
+Serves GET requests carrying a Range header. The range applies to the body only,
+overview and head are not sent. The total size of the body is reported in X-Body.
+*/
+func (b *BucketShare) getRange(id []byte, rng []byte, ctx *fasthttp.RequestCtx) {
+	var numbuf [16]byte
+	off,length,ok := parseRange(rng)
+	if !ok { ctx.Error("Bad Range",fasthttp.StatusRequestedRangeNotSatisfiable) ; return }
+	body,size,ok,e := bucketstore.GetRange(b.Store,id,off,length)
+	if e==bucketstore.ERange { ctx.Error("Range not satisfiable",fasthttp.StatusRequestedRangeNotSatisfiable) ; return }
+	if e!=nil { b.m.getErr.Inc() ; ctx.Error("Storage error "+e.Error(),fasthttp.StatusInternalServerError); return }
+	if !ok { b.m.getMiss.Inc() ; ctx.Error("Not found",fasthttp.StatusNotFound); return }
+	off,length,_ = bucketstore.ClipRange(off,length,size)
+	b.m.getOk.Inc()
+	b.m.getBytes.Add(uint64(length))
+	ctx.Response.Header.SetBytesV("X-Body",binarix.Itoa(size,numbuf[:0]))
+	if length>0 {
+		ctx.Response.Header.Set("Content-Range","bytes "+strconv.FormatInt(off,10)+"-"+strconv.FormatInt(off+length-1,10)+"/"+strconv.FormatInt(size,10))
+	}
+	ctx.SetStatusCode(fasthttp.StatusPartialContent)
+	/* fasthttp closes the stream, once it has been sent. */
+	ctx.SetBodyStream(body,int(length))
+}
+
+// Implements bucketstore.RangeGetter.
+func (c *Client) GetRange(id []byte, off, length int64) (body io.ReadCloser, size int64, ok bool, err error) {
+	/* An empty range can't be expressed in a Range header. */
+	if length==0 { return nil,0,false,bucketstore.EBadRequest }
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	
+	c.setUrl(req,id,[]byte("4"))
+	req.Header.SetMethod("GET")
+	rng := "bytes="+strconv.FormatInt(off,10)+"-"
+	if length>0 { rng += strconv.FormatInt(off+length-1,10) }
+	req.Header.Set("Range",rng)
+	
+	required(req)
+	err = c.client.DoDeadline(req,resp,time.Now().Add(time.Second*10))
+	
+	if err!=nil { return }
+	
+	fasthttp.ReleaseRequest(req)
+	
+	switch resp.StatusCode() {
+	case fasthttp.StatusPartialContent:
+	case fasthttp.StatusRequestedRangeNotSatisfiable:
+		fasthttp.ReleaseResponse(resp)
+		return nil,0,false,bucketstore.ERange
+	default:
+		fasthttp.ReleaseResponse(resp)
+		return
+	}
+	
+	size = binarix.Atoi(resp.Header.Peek("X-Body"))
+	
+	/* The range is handed out without copying, the response is released on Close. */
+	return &respReader{bytes.NewReader(resp.Body()),resp},size,true,nil
+}
+
+func (m *MultiClient) OverGetRange(bucket []byte, id []byte, off, length int64) (body io.ReadCloser, size int64, ok bool, e error) {
+	c := Client{m.client,bucket,degrader.Degrader{}}
+	return c.GetRange(id,off,length)
+}
@@ -31,50 +31,108 @@ import "github.com/maxymania/fastnntp-polyglot-labs/binarix"
 import "time"
 
 import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore/degrader"
+import "github.com/maxymania/fastnntp-polyglot-labs/metrics"
 
 type BucketRouter struct{
 	locals  map[string]*BucketShare
 	remotes map[string]*Client
+	modes   map[string]bucketstore.Mode
+	classes map[string]string
 	remlock sync.Mutex
 	uuids   []string
 	postick int
 	Dmd     *degrader.DegraderMetadata
+	
+	// Storage class to use, if all buckets of the requested class are full. "" = any bucket.
+	Fallback string
+	
+	// Admin API (api.admin). Control operations are refused, unless AdminToken is set.
+	AdminToken string
+	Cluster    ClusterInfo // Optional.
 }
 func NewBucketRouter() *BucketRouter {
 	return &BucketRouter{
 		remotes: make(map[string]*Client),
 		locals: make(map[string]*BucketShare),
+		modes: make(map[string]bucketstore.Mode),
+		classes: make(map[string]string),
 	}
 }
-func (b *BucketRouter) AddLocal(bu *bucketstore.Bucket) {
-	if _,ok := b.locals[bu.Uuid] ; ok { return }
+/*
+Adds a local bucket. If the UUID is already served by this router (as a different local
+bucket or as a remote one), the bucket is refused with bucketstore.ECollision.
+*/
+func (b *BucketRouter) AddLocal(bu *bucketstore.Bucket) error {
+	b.remlock.Lock(); defer b.remlock.Unlock()
+	if lc,ok := b.locals[bu.Uuid] ; ok {
+		if lc.Store==bu.Store { return nil }
+		return bucketstore.ECollision
+	}
+	if _,ok := b.remotes[bu.Uuid] ; ok { return bucketstore.ECollision }
 	bush := NewBucketShare(bu.Store)
 	bush.degr.Dmd = b.Dmd
+	bush.SetMode(bu.Mode)
+	registerLocal(bu.Uuid,bush)
 	b.locals[bu.Uuid] = bush
+	if !bu.Mode.Writable() { b.modes[bu.Uuid] = bu.Mode }
+	if bu.Ident!=nil {
+		if cl := bu.Ident.Labels[bucketstore.ClassLabel] ; cl!="" { b.classes[bu.Uuid] = cl }
+	}
 	b.uuids = append(b.uuids,bu.Uuid)
+	return nil
 }
-func (b *BucketRouter) AddNode(names [][]byte,cli HttpClient) {
+
+/*
+Adds the buckets of a remote node. Names, that collide with a local bucket or with a bucket
+of an other node are refused and returned.
+*/
+func (b *BucketRouter) AddNode(names [][]byte,cli HttpClient) (refused []string) {
 	b.remlock.Lock(); defer b.remlock.Unlock()
 	for _,name := range names {
 		sn := string(name)
-		b.remotes[sn] = &Client{cli,name,degrader.Degrader{Dmd:b.Dmd}}
-		b.uuids = append(b.uuids,sn)
+		if !b.addRemote(sn,cli) { refused = append(refused,sn) }
 	}
+	return
 }
-func (b *BucketRouter) AddNode2(names []string,cli HttpClient) {
+func (b *BucketRouter) AddNode2(names []string,cli HttpClient) (refused []string) {
 	b.remlock.Lock(); defer b.remlock.Unlock()
 	for _,sn := range names {
-		b.remotes[sn] = &Client{cli,[]byte(sn),degrader.Degrader{Dmd:b.Dmd}}
-		b.uuids = append(b.uuids,sn)
+		if !b.addRemote(sn,cli) { refused = append(refused,sn) }
 	}
+	return
+}
+func (b *BucketRouter) addRemote(sn string,cli HttpClient) bool {
+	if _,ok := b.locals[sn] ; ok { return false }
+	if rc,ok := b.remotes[sn] ; ok { return rc.client==cli }
+	rc := &Client{cli,[]byte(sn),degrader.Degrader{Dmd:b.Dmd}}
+	registerRemote(sn,rc)
+	b.remotes[sn] = rc
+	b.uuids = append(b.uuids,sn)
+	return true
 }
 func (b *BucketRouter) Remove2(names []string) {
 	b.remlock.Lock(); defer b.remlock.Unlock()
 	m := make(map[string]bool,len(names))
 	for _,name := range names {
 		m[name]=true
+		if _,ok := b.remotes[name] ; ok { unregisterBucket(name) }
 		delete(b.remotes,name)
+		delete(b.modes,name)
+		delete(b.classes,name)
 	}
+	b.removeUuids(m)
+}
+
+// Removes a local bucket, for example, after it has been drained and retired.
+func (b *BucketRouter) RemoveLocal(name string) {
+	b.remlock.Lock(); defer b.remlock.Unlock()
+	if _,ok := b.locals[name] ; ok { unregisterBucket(name) }
+	delete(b.locals,name)
+	delete(b.modes,name)
+	delete(b.classes,name)
+	b.removeUuids(map[string]bool{name:true})
+}
+func (b *BucketRouter) removeUuids(m map[string]bool) {
 	i := 0
 	for _,uuid := range b.uuids {
 		if m[uuid] { continue }
@@ -84,6 +142,41 @@ func (b *BucketRouter) Remove2(names []string) {
 	b.uuids = b.uuids[:i]
 }
 
+/*
+Sets the mode of a bucket (local or remote). Non-writable buckets still serve reads and expiry,
+but apiSubmit will not place new articles in them.
+*/
+func (b *BucketRouter) SetMode(name string, m bucketstore.Mode) {
+	b.remlock.Lock(); defer b.remlock.Unlock()
+	if lc := b.locals[name] ; lc!=nil { lc.SetMode(m) }
+	if m.Writable() {
+		delete(b.modes,name)
+	} else {
+		b.modes[name] = m
+	}
+}
+func (b *BucketRouter) Mode(name string) bucketstore.Mode {
+	b.remlock.Lock(); defer b.remlock.Unlock()
+	return b.modes[name]
+}
+// Sets the storage class of a bucket (local or remote).
+func (b *BucketRouter) SetClass(name, class string) {
+	b.remlock.Lock(); defer b.remlock.Unlock()
+	if class=="" {
+		delete(b.classes,name)
+	} else {
+		b.classes[name] = class
+	}
+}
+func (b *BucketRouter) Class(name string) string {
+	b.remlock.Lock(); defer b.remlock.Unlock()
+	return b.classes[name]
+}
+func (b *BucketRouter) local(name string) *BucketShare {
+	b.remlock.Lock(); defer b.remlock.Unlock()
+	return b.locals[name]
+}
+
 func (b *BucketRouter) apiSubmit(path binarix.Iterator,ctx *fasthttp.RequestCtx) {
 	var idbuf [100]byte
 	id,err := decode(path.Split('/'),idbuf[:])
@@ -102,54 +195,91 @@ func (b *BucketRouter) apiSubmit(path binarix.Iterator,ctx *fasthttp.RequestCtx)
 	bodyf := headl+overl
 	
 	
-	uuids := b.uuids
-	if len(uuids)==0 {
+	if len(b.uuids)==0 {
+		mSubmit[submitFull].Inc()
 		ctx.Error("Out of Storage Space",fasthttp.StatusInsufficientStorage)
 		return
 	}
+	class := string(ctx.Request.Header.Peek("X-Class"))
+	if b.place(class,id.Bytes(),rdata,overl,bodyf,expire,ctx) { return }
+	
+	/* No bucket of the requested class has room left: use the fallback class. */
+	if fb := b.Fallback ; class!="" && fb!=class {
+		if b.place(fb,id.Bytes(),rdata,overl,bodyf,expire,ctx) { return }
+	}
+	
+	/*
+	 * If we looped through all Nodes and then determined, that no one fits: Out of Storage.
+	 */
+	mSubmit[submitFull].Inc()
+	ctx.Error("Insufficient Storage",fasthttp.StatusInsufficientStorage)
+	return
+}
+/*
+Tries to place the article in a bucket of the given storage class ("" = any bucket).
+Returns false, if no bucket could take the article.
+*/
+func (b *BucketRouter) place(class string, id, rdata []byte, overl, bodyf int64, expire time.Time, ctx *fasthttp.RequestCtx) bool {
+	var err error
+	size := int64(len(rdata))
+	uuids := b.uuids
 	for i := 0 ; i<len(uuids) ; i++ {
 	
 		postick := b.postick
 		if postick >= len(uuids) { postick = 0 }
 		uuid := uuids[postick]
 		b.postick = postick+1
+		
+		/* Read-only and draining buckets don't take new articles. */
+		if !b.Mode(uuid).Writable() { continue }
+		
+		if class!="" && b.Class(uuid)!=class { continue }
 	
-		if lc := b.locals[uuid] ; lc!=nil {
+		if lc := b.local(uuid) ; lc!=nil {
 			
 			/* Check, if our bucket had a failure recently. */
 			if lc.degr.Damaged() { continue }
 			
 			/* Check Length. We must not exceed the available storage space. */
 			lng := atomic.LoadInt64(&lc.spcLeft)
-			if lng<(overl+headl+bodyl) {
+			if lng<size {
 				continue
 			}
 			
-			err = lc.Store.Put(id.Bytes(), rdata[:overl], rdata[overl:bodyf], rdata[bodyf:], expire)
+			err = lc.Store.Put(id, rdata[:overl], rdata[overl:bodyf], rdata[bodyf:], expire)
 			if err==bucketstore.EExists {
+				lc.m.putExists.Inc()
+				mSubmit[submitExists].Inc()
 				ctx.Error("Object Already Exists",fasthttp.StatusConflict)
-				return
+				ctx.Response.Header.Set("X-Bucket",uuid)
+				return true
 			}
 			if err==bucketstore.EOutOfStorage {
 				/* Out of storage: set the Out of Storage variable to ZERO. */
+				lc.m.putFull.Inc()
 				atomic.StoreInt64(&lc.spcLeft,0)
 				continue
 			}
 			if err==bucketstore.ETemporaryFailure {
+				lc.m.putErr.Inc()
 				lc.degr.ForceFail()
 				continue
 			}
 			if err!=nil {
+				lc.m.putErr.Inc()
 				lc.degr.Fail()
 				continue
 			}
-			atomic.AddInt64(&lc.spcLeft,overl+headl+bodyl) // inaccurate update.
+			atomic.AddInt64(&lc.spcLeft,size) // inaccurate update.
 			
 			lc.Wakeup() // Let the background process do it's job
 			
+			lc.m.putOk.Inc()
+			lc.m.putBytes.Add(uint64(size))
+			mSubmit[submitCreated].Inc()
 			ctx.SetStatusCode(fasthttp.StatusCreated)
 			ctx.Response.Header.Set("X-Bucket",uuid)
-			return
+			return true
 		}
 		
 		b.remlock.Lock()
@@ -166,14 +296,21 @@ func (b *BucketRouter) apiSubmit(path binarix.Iterator,ctx *fasthttp.RequestCtx)
 				continue
 			}
 			
-			if lng<(overl+headl+bodyl) {
+			if lng<size {
 				continue
 			}
 			
-			err = cli.Put(id.Bytes(), rdata[:overl], rdata[overl:bodyf], rdata[bodyf:], expire)
+			err = cli.Put(id, rdata[:overl], rdata[overl:bodyf], rdata[bodyf:], expire)
 			if err==bucketstore.EExists {
+				mSubmit[submitExists].Inc()
 				ctx.Error("Object Already Exists",fasthttp.StatusConflict)
-				return
+				ctx.Response.Header.Set("X-Bucket",uuid)
+				return true
+			}
+			if err==bucketstore.EReadOnly {
+				/* The bucket's mode changed, but the gossip didn't reach us yet. */
+				b.SetMode(uuid,bucketstore.ModeReadOnly)
+				continue
 			}
 			if err==bucketstore.EOutOfStorage {
 				/* We augment Out Of Storage errors by telling the degrader "broken". */
@@ -189,17 +326,14 @@ func (b *BucketRouter) apiSubmit(path binarix.Iterator,ctx *fasthttp.RequestCtx)
 				continue
 			}
 			
+			mSubmit[submitCreated].Inc()
 			ctx.SetStatusCode(fasthttp.StatusCreated)
 			ctx.Response.Header.Set("X-Bucket",uuid)
-			return
+			return true
 		}
 	}
 	
-	/*
-	 * If we looped through all Nodes and then determined, that no one fits: Out of Storage.
-	 */
-	ctx.Error("Insufficient Storage",fasthttp.StatusInsufficientStorage)
-	return
+	return false
 }
 func (b *BucketRouter) Handler(ctx *fasthttp.RequestCtx) {
 	path := binarix.Iterator{ctx.Path()}
@@ -210,9 +344,15 @@ func (b *BucketRouter) Handler(ctx *fasthttp.RequestCtx) {
 	case "api.submit":
 		b.apiSubmit(path,ctx)
 		return
+	case "api.metrics":
+		metrics.Default.Handler(ctx)
+		return
+	case "api.admin":
+		b.apiAdmin(path,ctx)
+		return
 	}
 	
-	if lc := b.locals[string(buuid)] ; lc!=nil {
+	if lc := b.local(string(buuid)) ; lc!=nil {
 		lc.Handler(ctx)
 		return
 	}
@@ -0,0 +1,130 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package remote
+
+import "fmt"
+import "time"
+import "github.com/valyala/fasthttp"
+import "github.com/vmihailenco/msgpack"
+import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore"
+import "github.com/maxymania/fastnntp-polyglot-labs/bufferex"
+import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore/degrader"
+
+/*
+Paginated scan: GET /<bucket>/-?token=...&from=...&to=...&limit=...
+
+token is the (base64 encoded) token of the previous page, from and to are URLDate-formatted.
+The response is a msgpack encoded scanPage.
+*/
+type scanRecord struct{
+	_msgpack struct{} `msgpack:",asArray"`
+	Id []byte
+	Over, Head, Body int
+	Stored, Expire int64 // Unix time, Stored=0 if unknown.
+}
+type scanPage struct{
+	_msgpack struct{} `msgpack:",asArray"`
+	Entries []scanRecord
+	Next    []byte
+}
+
+func parseURLDate(b []byte) (time.Time,error) {
+	if len(b)==0 { return time.Time{},nil }
+	return time.ParseInLocation(URLDate,string(b),time.UTC)
+}
+
+func (b *BucketShare) scan(ctx *fasthttp.RequestCtx) {
+	var filter bucketstore.ScanFilter
+	var token bufferex.Binary
+	var err,err1,err2 error
+	args := ctx.QueryArgs()
+	if t := args.Peek("token") ; len(t)>0 { token,err = decode(t,nil) }
+	filter.ExpireFrom,err1 = parseURLDate(args.Peek("from"))
+	filter.ExpireTo,err2 = parseURLDate(args.Peek("to"))
+	if err!=nil || err1!=nil || err2!=nil { ctx.Error("Bad Request",fasthttp.StatusBadRequest) ; return }
+	defer token.Free()
+	
+	ents,next,err := bucketstore.Scan(b.Store,token.Bytes(),filter,args.GetUintOrZero("limit"))
+	if err==bucketstore.ENotSupported { ctx.Error("Not Implemented",fasthttp.StatusNotImplemented) ; return }
+	if err==bucketstore.EBadRequest { ctx.Error("Bad Request",fasthttp.StatusBadRequest) ; return }
+	if err!=nil { ctx.Error("IO Error",fasthttp.StatusInternalServerError) ; return }
+	
+	page := scanPage{Entries:make([]scanRecord,len(ents)),Next:next}
+	for i,ent := range ents {
+		r := &page.Entries[i]
+		r.Id,r.Over,r.Head,r.Body,r.Expire = ent.Id,ent.Over,ent.Head,ent.Body,ent.Expire.Unix()
+		if !ent.Stored.IsZero() { r.Stored = ent.Stored.Unix() }
+	}
+	buf,err := msgpack.Marshal(&page)
+	if err!=nil { ctx.Error("Internal Server Error",fasthttp.StatusInternalServerError) ; return }
+	ctx.Write(buf)
+}
+
+// Implements bucketstore.Scanner.
+func (c *Client) Scan(token []byte, filter bucketstore.ScanFilter, limit int) (entries []bucketstore.ScanEntry, next []byte, err error) {
+	var buf [32]byte
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	
+	req.Header.SetMethod("GET")
+	req.SetRequestURI(fmt.Sprintf("/%s/-",c.uuid))
+	args := req.URI().QueryArgs()
+	if len(token)>0 { args.Set("token",codec.EncodeToString(token)) }
+	if !filter.ExpireFrom.IsZero() { args.SetBytesV("from",filter.ExpireFrom.UTC().AppendFormat(buf[:0],URLDate)) }
+	if !filter.ExpireTo.IsZero() { args.SetBytesV("to",filter.ExpireTo.UTC().AppendFormat(buf[:0],URLDate)) }
+	if limit>0 { args.SetUint("limit",limit) }
+	
+	required(req)
+	err = c.client.DoDeadline(req,resp,time.Now().Add(time.Second*10))
+	
+	if err!=nil { return }
+	
+	fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+	
+	switch resp.StatusCode() {
+	case fasthttp.StatusOK:
+	case fasthttp.StatusNotImplemented: return nil,nil,bucketstore.ENotSupported
+	case fasthttp.StatusBadRequest:     return nil,nil,bucketstore.EBadRequest
+	case fasthttp.StatusNotFound:       return nil,nil,bucketstore.ENoBucket
+	default:                            return nil,nil,bucketstore.EDiskFailure
+	}
+	
+	var page scanPage
+	if err = msgpack.Unmarshal(resp.Body(),&page) ; err!=nil { return }
+	entries = make([]bucketstore.ScanEntry,len(page.Entries))
+	for i,r := range page.Entries {
+		ent := &entries[i]
+		ent.Id,ent.Over,ent.Head,ent.Body,ent.Expire = r.Id,r.Over,r.Head,r.Body,time.Unix(r.Expire,0).UTC()
+		if r.Stored!=0 { ent.Stored = time.Unix(r.Stored,0).UTC() }
+	}
+	next = page.Next
+	return
+}
+
+func (m *MultiClient) OverScan(bucket []byte, token []byte, filter bucketstore.ScanFilter, limit int) (entries []bucketstore.ScanEntry, next []byte, e error) {
+	c := Client{m.client,bucket,degrader.Degrader{}}
+	return c.Scan(token,filter,limit)
+}
@@ -39,6 +39,7 @@ import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore/degrader"
 const (
 	statusTemporaryFailure = 900+iota
 	statusDiskFailure
+	statusReadOnly
 )
 
 var codec = base64.RawURLEncoding
@@ -60,13 +61,15 @@ func decode(buf []byte,targ []byte) (bufferex.Binary, error){
 
 type BucketShare struct{
 	spcLeft  int64
+	mode     uint32
 	Store    bucketstore.BucketStore
 	signaler chan int
 	degr     degrader.Degrader
+	m        *shareMetrics
 }
 const URLDate = "20060102150405"
 func NewBucketShare(s bucketstore.BucketStore) *BucketShare {
-	bkt := &BucketShare{Store:s,signaler:make(chan int,1)}
+	bkt := &BucketShare{Store:s,signaler:make(chan int,1),m:newShareMetrics("")}
 	go bkt.Refresher()
 	bkt.Wakeup()
 	return bkt
@@ -81,6 +84,12 @@ func (b *BucketShare) Refresher() {
 		atomic.StoreInt64(&b.spcLeft,lng)
 	}
 }
+func (b *BucketShare) SetMode(m bucketstore.Mode) {
+	atomic.StoreUint32(&b.mode,uint32(m))
+}
+func (b *BucketShare) Mode() bucketstore.Mode {
+	return bucketstore.Mode(atomic.LoadUint32(&b.mode))
+}
 func (b *BucketShare) Wakeup() {
 	select {
 		case b.signaler <- 1:
@@ -95,10 +104,23 @@ func (b *BucketShare) Handler(ctx *fasthttp.RequestCtx) {
 	path.Split('/') // Bucket-ID+'/'
 	
 	if ctx.IsGet() {
-		id,err := decode(path.Split('/'),idbuf[:])
-		if err!=nil { ctx.Error("Bad Request",fasthttp.StatusBadRequest) }
+		elem := path.Split('/')
+		if string(elem)=="-" { // Paginated scan: /<bucket>/-
+			b.scan(ctx)
+			return
+		}
+		id,err := decode(elem,idbuf[:])
+		if err!=nil { ctx.Error("Bad Request",fasthttp.StatusBadRequest) ; return }
 		defer id.Free()
 		xid := binarix.Atoi(path.Split('/'))
+		if rng := ctx.Request.Header.Peek("Range") ; len(rng)!=0 {
+			b.getRange(id.Bytes(),rng,ctx)
+			return
+		}
+		if string(ctx.Request.Header.Peek("X-Stream"))=="1" {
+			b.getStream(id.Bytes(),xid,ctx)
+			return
+		}
 		var bover,bhead,bbody bufferex.Binary
 		var pover,phead,pbody *bufferex.Binary
 		if (xid&1)==1 { pover = &bover }
@@ -108,8 +130,10 @@ func (b *BucketShare) Handler(ctx *fasthttp.RequestCtx) {
 		defer bover.Free()
 		defer bhead.Free()
 		defer bbody.Free()
-		if e!=nil { ctx.Error("Storage error "+e.Error(),fasthttp.StatusInternalServerError); return }
-		if !ok { ctx.Error("Not found",fasthttp.StatusNotFound); return }
+		if e!=nil { b.m.getErr.Inc() ; ctx.Error("Storage error "+e.Error(),fasthttp.StatusInternalServerError); return }
+		if !ok { b.m.getMiss.Inc() ; ctx.Error("Not found",fasthttp.StatusNotFound); return }
+		b.m.getOk.Inc()
+		b.m.getBytes.Add(uint64(len(bover.Bytes())+len(bhead.Bytes())+len(bbody.Bytes())))
 		ctx.Response.Header.SetBytesV("X-Over",binarix.Itoa(int64(len(bover.Bytes())),numbuf[:0]))
 		ctx.Response.Header.SetBytesV("X-Head",binarix.Itoa(int64(len(bhead.Bytes())),numbuf[:0]))
 		ctx.Response.Header.SetBytesV("X-Body",binarix.Itoa(int64(len(bbody.Bytes())),numbuf[:0]))
@@ -119,7 +143,12 @@ func (b *BucketShare) Handler(ctx *fasthttp.RequestCtx) {
 		return
 	}
 	if ctx.IsPut() {
-		id,err := decode(path.Split('/'),idbuf[:])
+		elem := path.Split('/')
+		if string(elem)=="-" { // Multi-record PUT: /<bucket>/-
+			b.putMany(ctx)
+			return
+		}
+		id,err := decode(elem,idbuf[:])
 		if err!=nil { ctx.Error("Bad Request",fasthttp.StatusBadRequest) ; return }
 		expire,err := time.ParseInLocation(URLDate,string(path.Split('/')),time.UTC)
 		if err!=nil { ctx.Error("Bad Request",fasthttp.StatusBadRequest) ; return }
@@ -127,27 +156,51 @@ func (b *BucketShare) Handler(ctx *fasthttp.RequestCtx) {
 		overl := binarix.Atoi(ctx.Request.Header.Peek("X-Over"))
 		headl := binarix.Atoi(ctx.Request.Header.Peek("X-Head"))
 		bodyl := binarix.Atoi(ctx.Request.Header.Peek("X-Body"))
-		rdata := ctx.Request.Body()
-		if int64(len(rdata))!=(overl+headl+bodyl) {
-			ctx.Error("Bad Request",fasthttp.StatusBadRequest)
+		if !validLengths(overl,headl,bodyl) { ctx.Error("Bad Request",fasthttp.StatusBadRequest) ; return }
+		stream := ctx.RequestBodyStream()
+		var rdata []byte
+		if stream==nil {
+			rdata = ctx.Request.Body()
+			if int64(len(rdata))!=(overl+headl+bodyl) {
+				ctx.Error("Bad Request",fasthttp.StatusBadRequest)
+				return
+			}
+		}
+		if !b.Mode().Writable() {
+			b.m.putRO.Inc()
+			ctx.Error("Bucket is "+b.Mode().String(),statusReadOnly)
 			return
 		}
-		bodyf := headl+overl
 		lng := atomic.LoadInt64(&b.spcLeft)
 		if lng<(overl+headl+bodyl) {
+			b.m.putFull.Inc()
 			ctx.Error("Out of Storage Space",fasthttp.StatusInsufficientStorage)
 			return
 		}
 		
-		err = b.Store.Put(id.Bytes(), rdata[:overl], rdata[overl:bodyf], rdata[bodyf:], expire)
+		if stream!=nil {
+			err = b.putStream(id.Bytes(),stream,overl,headl,bodyl,expire)
+		} else {
+			bodyf := headl+overl
+			err = b.Store.Put(id.Bytes(), rdata[:overl], rdata[overl:bodyf], rdata[bodyf:], expire)
+		}
+		if err==bucketstore.EBadRequest {
+			ctx.Error("Bad Request",fasthttp.StatusBadRequest)
+			return
+		}
 		if err==bucketstore.EExists {
+			b.m.putExists.Inc()
 			ctx.Error("Object Already Exists",fasthttp.StatusConflict)
 			return
 		}
 		if err==bucketstore.EOutOfStorage {
+			b.m.putFull.Inc()
 			ctx.Error("Insufficient Storage",fasthttp.StatusInsufficientStorage)
 			return
 		}
+		if err!=nil {
+			b.m.putErr.Inc()
+		}
 		if err==bucketstore.ETemporaryFailure {
 			ctx.Error("Temporary Failure",statusTemporaryFailure)
 			return
@@ -156,6 +209,8 @@ func (b *BucketShare) Handler(ctx *fasthttp.RequestCtx) {
 			ctx.Error("Disk Failure",statusDiskFailure)
 			return
 		}
+		b.m.putOk.Inc()
+		b.m.putBytes.Add(uint64(overl+headl+bodyl))
 		
 		atomic.AddInt64(&b.spcLeft,overl+headl+bodyl) // inaccurate update.
 		
@@ -165,7 +220,12 @@ func (b *BucketShare) Handler(ctx *fasthttp.RequestCtx) {
 		return
 	}
 	if ctx.IsDelete() { // Expire
-		expire,err := time.ParseInLocation(URLDate,string(path.Split('/')),time.UTC)
+		elem := path.Split('/')
+		if string(path.Split('/'))=="-" { // Delete a single object: /<bucket>/<id>/-
+			b.delete(elem,idbuf[:],ctx)
+			return
+		}
+		expire,err := time.ParseInLocation(URLDate,string(elem),time.UTC)
 		if err!=nil { ctx.Error("Bad Request",fasthttp.StatusBadRequest) ; return }
 		err = b.Store.Expire(expire)
 		if err!=nil {
@@ -176,6 +236,10 @@ func (b *BucketShare) Handler(ctx *fasthttp.RequestCtx) {
 		return
 	}
 	if ctx.IsHead() {
+		if elem := path.Split('/') ; len(elem)>0 { // Stat a single object: /<bucket>/<id>
+			b.stat(elem,idbuf[:],ctx)
+			return
+		}
 		lng := atomic.LoadInt64(&b.spcLeft)
 		ctx.SetStatusCode(fasthttp.StatusNoContent)
 		ctx.Response.Header.SetBytesV("X-Free-Storage",binarix.Itoa(lng,numbuf[:0]))
@@ -184,7 +248,20 @@ func (b *BucketShare) Handler(ctx *fasthttp.RequestCtx) {
 	}
 	ctx.Error("Error 404",404)
 }
-
-
-
-
+func (b *BucketShare) delete(elem, idbuf []byte, ctx *fasthttp.RequestCtx) {
+	id,err := decode(elem,idbuf)
+	if err!=nil { ctx.Error("Bad Request",fasthttp.StatusBadRequest) ; return }
+	defer id.Free()
+	d,ok := b.Store.(bucketstore.Deleter)
+	if !ok { ctx.Error("Not Implemented",fasthttp.StatusNotImplemented) ; return }
+	err = d.Delete(id.Bytes())
+	if err==bucketstore.ETemporaryFailure {
+		ctx.Error("Temporary Failure",statusTemporaryFailure)
+		return
+	}
+	if err!=nil {
+		ctx.Error("IO Error",fasthttp.StatusInternalServerError)
+		return
+	}
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+}
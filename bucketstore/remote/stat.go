@@ -0,0 +1,90 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package remote
+
+import "fmt"
+import "time"
+import "github.com/valyala/fasthttp"
+import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore"
+import "github.com/maxymania/fastnntp-polyglot-labs/binarix"
+import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore/degrader"
+
+/*
+Serves HEAD /<bucket>/<id>. The sizes are returned in X-Over, X-Head and X-Body,
+the expiry and the time, the object has been stored at, in X-Expire and X-Stored (URLDate, omitted if unknown).
+*/
+func (b *BucketShare) stat(elem, idbuf []byte, ctx *fasthttp.RequestCtx) {
+	var numbuf [16]byte
+	id,err := decode(elem,idbuf)
+	if err!=nil { ctx.Error("Bad Request",fasthttp.StatusBadRequest) ; return }
+	defer id.Free()
+	st,ok,err := bucketstore.Stat(b.Store,id.Bytes())
+	if err!=nil { ctx.Error("Storage error "+err.Error(),fasthttp.StatusInternalServerError); return }
+	if !ok { ctx.Error("Not found",fasthttp.StatusNotFound); return }
+	ctx.Response.Header.SetBytesV("X-Over",binarix.Itoa(int64(st.Over),numbuf[:0]))
+	ctx.Response.Header.SetBytesV("X-Head",binarix.Itoa(int64(st.Head),numbuf[:0]))
+	ctx.Response.Header.SetBytesV("X-Body",binarix.Itoa(int64(st.Body),numbuf[:0]))
+	if !st.Expire.IsZero() { ctx.Response.Header.SetBytesV("X-Expire",st.Expire.UTC().AppendFormat(numbuf[:0],URLDate)) }
+	if !st.Stored.IsZero() { ctx.Response.Header.SetBytesV("X-Stored",st.Stored.UTC().AppendFormat(numbuf[:0],URLDate)) }
+	ctx.SetStatusCode(fasthttp.StatusOK)
+}
+
+// Implements bucketstore.Stater.
+func (c *Client) Stat(id []byte) (st bucketstore.ObjectStat, ok bool, err error) {
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	
+	c.setUrl(req,id,nil)
+	req.Header.SetMethod("HEAD")
+	
+	required(req)
+	err = c.client.DoDeadline(req,resp,time.Now().Add(time.Second))
+	
+	if err!=nil { return }
+	
+	fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+	
+	switch resp.StatusCode() {
+	case fasthttp.StatusOK:
+	case fasthttp.StatusNotFound: return
+	default:
+		err = fmt.Errorf("Stat: status %d",resp.StatusCode())
+		return
+	}
+	
+	st.Over = int(binarix.Atoi(resp.Header.Peek("X-Over")))
+	st.Head = int(binarix.Atoi(resp.Header.Peek("X-Head")))
+	st.Body = int(binarix.Atoi(resp.Header.Peek("X-Body")))
+	st.Expire,_ = parseURLDate(resp.Header.Peek("X-Expire"))
+	st.Stored,_ = parseURLDate(resp.Header.Peek("X-Stored"))
+	ok = true
+	return
+}
+
+func (m *MultiClient) OverStat(bucket []byte, id []byte) (st bucketstore.ObjectStat, ok bool, e error) {
+	c := Client{m.client,bucket,degrader.Degrader{}}
+	return c.Stat(id)
+}
@@ -0,0 +1,207 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package remote
+
+import "bytes"
+import "io"
+import "math"
+import "time"
+import "github.com/valyala/fasthttp"
+import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore"
+import "github.com/maxymania/fastnntp-polyglot-labs/bufferex"
+import "github.com/maxymania/fastnntp-polyglot-labs/binarix"
+import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore/degrader"
+
+/*
+Streaming variants of Get and Put.
+
+The sender streams the message with chunked transfer encoding, so it never holds the whole
+body in memory. The receiver reads the body from the connection, if the transport supports
+it (a fasthttp.Server with StreamRequestBody, a fasthttp.HostClient with StreamResponseBody),
+otherwise it falls back to the buffered message.
+*/
+
+type streamCloser struct{
+	io.Reader
+	c io.Closer
+}
+func (s streamCloser) Close() error { return s.c.Close() }
+
+type respReader struct{
+	io.Reader
+	resp *fasthttp.Response
+}
+func (r *respReader) Close() error {
+	if r.resp!=nil { r.resp.CloseBodyStream() ; fasthttp.ReleaseResponse(r.resp) ; r.resp = nil }
+	return nil
+}
+
+/* The overview and the head of a streamed message are read into memory, so they are limited. */
+const maxPrefix = 1<<24
+
+/*
+Checks the X-Over, X-Head and X-Body lengths sent by the peer: none of them may be negative,
+and their sum must not overflow.
+*/
+func validLengths(overl, headl, bodyl int64) bool {
+	if overl<0 || headl<0 || bodyl<0 { return false }
+	if overl>math.MaxInt64-headl { return false }
+	return bodyl<=math.MaxInt64-(overl+headl)
+}
+
+// Reads the overview and the head from a streamed message.
+func readPrefix(s io.Reader, overl, headl, bodyl int64) (over, head []byte, err error) {
+	if !validLengths(overl,headl,bodyl) || overl+headl>maxPrefix { return nil,nil,bucketstore.EBadRequest }
+	pre := make([]byte,overl+headl)
+	if _,err = io.ReadFull(s,pre) ; err!=nil { return nil,nil,bucketstore.EBadRequest }
+	return pre[:overl],pre[overl:],nil
+}
+
+// Serves PUT requests, whose body is streamed by the server.
+func (b *BucketShare) putStream(id []byte, s io.Reader, overl, headl, bodyl int64, expire time.Time) error {
+	over,head,err := readPrefix(s,overl,headl,bodyl)
+	if err!=nil { return err }
+	return bucketstore.PutReader(b.Store,id,over,head,io.LimitReader(s,bodyl),bodyl,expire)
+}
+
+// Serves GET requests carrying "X-Stream: 1".
+func (b *BucketShare) getStream(id []byte, xid int64, ctx *fasthttp.RequestCtx) {
+	var numbuf [16]byte
+	var bover,bhead bufferex.Binary
+	var pover,phead *bufferex.Binary
+	if (xid&1)==1 { pover = &bover }
+	if (xid&2)==2 { phead = &bhead }
+	defer bover.Free()
+	defer bhead.Free()
+	var body io.ReadCloser
+	var size int64
+	var ok bool
+	var e error
+	if (xid&4)==4 {
+		body,size,ok,e = bucketstore.GetReader(b.Store,id,pover,phead)
+	} else {
+		ok,e = b.Store.Get(id,pover,phead,nil)
+	}
+	if e!=nil { b.m.getErr.Inc() ; ctx.Error("Storage error "+e.Error(),fasthttp.StatusInternalServerError); return }
+	if !ok { b.m.getMiss.Inc() ; ctx.Error("Not found",fasthttp.StatusNotFound); return }
+	b.m.getOk.Inc()
+	b.m.getBytes.Add(uint64(int64(len(bover.Bytes())+len(bhead.Bytes()))+size))
+	ctx.Response.Header.SetBytesV("X-Over",binarix.Itoa(int64(len(bover.Bytes())),numbuf[:0]))
+	ctx.Response.Header.SetBytesV("X-Head",binarix.Itoa(int64(len(bhead.Bytes())),numbuf[:0]))
+	ctx.Response.Header.SetBytesV("X-Body",binarix.Itoa(size,numbuf[:0]))
+	prefix := append(append([]byte(nil),bover.Bytes()...),bhead.Bytes()...)
+	if body==nil {
+		ctx.Write(prefix)
+		return
+	}
+	/* fasthttp closes the stream, once it has been sent. */
+	ctx.SetBodyStream(streamCloser{io.MultiReader(bytes.NewReader(prefix),body),body},-1)
+}
+
+// Implements bucketstore.StreamGetter.
+func (c *Client) GetReader(id []byte, overv, head *bufferex.Binary) (body io.ReadCloser, size int64, ok bool, err error) {
+	var buf [1]byte
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	
+	buf[0] = 4
+	if overv!= nil { buf[0]|=1 }
+	if head != nil { buf[0]|=2 }
+	buf[0] += '0'
+	
+	c.setUrl(req,id,buf[:])
+	req.Header.SetMethod("GET")
+	req.Header.Set("X-Stream","1")
+	
+	required(req)
+	resp.StreamBody = true
+	err = c.client.DoDeadline(req,resp,time.Now().Add(time.Second*10))
+	
+	if err!=nil { return }
+	
+	fasthttp.ReleaseRequest(req)
+	
+	if resp.StatusCode()!=fasthttp.StatusOK { fasthttp.ReleaseResponse(resp) ; return }
+	
+	overl := binarix.Atoi(resp.Header.Peek("X-Over"))
+	headl := binarix.Atoi(resp.Header.Peek("X-Head"))
+	bodyl := binarix.Atoi(resp.Header.Peek("X-Body"))
+	
+	if s := resp.BodyStream() ; s!=nil {
+		bover,bhead,e := readPrefix(s,overl,headl,bodyl)
+		if e!=nil { resp.CloseBodyStream() ; fasthttp.ReleaseResponse(resp) ; return }
+		if overv!=nil { *overv = bufferex.NewBinary(bover) }
+		if head!=nil { *head = bufferex.NewBinary(bhead) }
+		
+		/* The body is read from the connection, the response is released on Close. */
+		return &respReader{io.LimitReader(s,bodyl),resp},bodyl,true,nil
+	}
+	
+	rdata := resp.Body()
+	if int64(len(rdata))!=(overl+headl+bodyl) { fasthttp.ReleaseResponse(resp) ; return }
+	
+	if overv!=nil { *overv = bufferex.NewBinary(rdata[:overl]) }
+	rdata = rdata[overl:]
+	if head!=nil { *head = bufferex.NewBinary(rdata[:headl]) }
+	rdata = rdata[headl:]
+	
+	/* The body is handed out without copying, the response is released on Close. */
+	return &respReader{bytes.NewReader(rdata),resp},bodyl,true,nil
+}
+
+// Implements bucketstore.StreamPutter.
+func (c *Client) PutReader(id, overv, head []byte, body io.Reader, size int64, expire time.Time) error {
+	var buf [32]byte
+	var numbuf [16]byte
+	
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	
+	c.setUrl(req,id,expire.AppendFormat(buf[:0],URLDate))
+	req.Header.SetMethod("PUT")
+	
+	req.Header.SetBytesV("X-Over",binarix.Itoa(int64(len(overv)),numbuf[:0]))
+	req.Header.SetBytesV("X-Head",binarix.Itoa(int64(len(head )),numbuf[:0]))
+	req.Header.SetBytesV("X-Body",binarix.Itoa(size,numbuf[:0]))
+	
+	req.SetBodyStream(io.MultiReader(bytes.NewReader(overv),bytes.NewReader(head),io.LimitReader(body,size)),-1)
+	
+	required(req)
+	err := c.client.DoDeadline(req,resp,time.Now().Add(time.Second*10))
+	
+	if err!=nil { return err }
+	
+	fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+	
+	return putError(resp.StatusCode())
+}
+
+func (m *MultiClient) OverGetReader(bucket []byte, id []byte, overv, head *bufferex.Binary) (body io.ReadCloser, size int64, ok bool, e error) {
+	c := Client{m.client,bucket,degrader.Degrader{}}
+	return c.GetReader(id,overv,head)
+}
+func (m *MultiClient) OverPutReader(bucket []byte, id, overv, head []byte, body io.Reader, size int64, expire time.Time) error {
+	c := Client{m.client,bucket,degrader.Degrader{}}
+	return c.PutReader(id,overv,head,body,size,expire)
+}
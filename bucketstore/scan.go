@@ -0,0 +1,88 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package bucketstore
+
+import "time"
+
+// An object, as yielded by Scan. Sizes are -1, if unknown. Stored is zero, if unknown.
+type ScanEntry struct{
+	Id               []byte
+	Over, Head, Body int
+	Stored, Expire   time.Time
+}
+
+/*
+Restricts a Scan to objects expiring within [ExpireFrom,ExpireTo].
+A zero time leaves the respective end unbounded.
+*/
+type ScanFilter struct{
+	ExpireFrom, ExpireTo time.Time
+}
+func (f *ScanFilter) Match(expire time.Time) bool {
+	if !f.ExpireFrom.IsZero() && expire.Before(f.ExpireFrom) { return false }
+	if !f.ExpireTo.IsZero() && expire.After(f.ExpireTo) { return false }
+	return true
+}
+
+/*
+Optional interface. Enumerates the objects of a bucket page by page. Each call returns at most
+limit entries and an opaque token, that resumes the scan after the last entry. The token is nil,
+once the scan is complete. A nil token starts a new scan. The token must be used with the same
+filter only.
+*/
+type Scanner interface{
+	Scan(token []byte, filter ScanFilter, limit int) (entries []ScanEntry, next []byte, e error)
+}
+
+// Optional interface of an OverStore. See Scanner.
+type OverScanner interface{
+	OverScan(bucket []byte, token []byte, filter ScanFilter, limit int) (entries []ScanEntry, next []byte, e error)
+}
+
+/*
+Uses Scanner, if implemented by s, AgeLister otherwise. In the latter case, the sizes are unknown,
+and the token is the ID of the last entry.
+*/
+func Scan(s BucketStore, token []byte, filter ScanFilter, limit int) (entries []ScanEntry, next []byte, e error) {
+	if sc,ok := s.(Scanner) ; ok { return sc.Scan(token,filter,limit) }
+	lst,ok := s.(AgeLister)
+	if !ok { return nil,nil,ENotSupported }
+	if limit<=0 { limit = 256 }
+	e = lst.ListAge(token,func(id []byte, stored, expire time.Time) bool {
+		if len(entries)==limit { next = append([]byte(nil),entries[limit-1].Id...) ; return false }
+		if filter.Match(expire) {
+			entries = append(entries,ScanEntry{append([]byte(nil),id...),-1,-1,-1,stored,expire})
+		}
+		return true
+	})
+	if e!=nil { return nil,nil,e }
+	return
+}
+
+// Uses OverScanner, if implemented by s. Returns ENotSupported otherwise.
+func OverScan(s OverStore, bucket []byte, token []byte, filter ScanFilter, limit int) (entries []ScanEntry, next []byte, e error) {
+	if sc,ok := s.(OverScanner) ; ok { return sc.OverScan(bucket,token,filter,limit) }
+	return nil,nil,ENotSupported
+}
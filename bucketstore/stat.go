@@ -0,0 +1,66 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package bucketstore
+
+import "time"
+import "github.com/maxymania/fastnntp-polyglot-labs/bufferex"
+
+// Sizes and expiry of an object. Stored and Expire are zero, if unknown.
+type ObjectStat struct{
+	Over, Head, Body int
+	Stored, Expire   time.Time
+}
+
+// Optional interface. Returns the sizes and expiry of an object from the index, without reading its data.
+type Stater interface{
+	Stat(id []byte) (st ObjectStat, ok bool, e error)
+}
+
+// Optional interface of an OverStore. See Stater.
+type OverStater interface{
+	OverStat(bucket []byte, id []byte) (st ObjectStat, ok bool, e error)
+}
+
+func statGet(get func(overv, head, body *bufferex.Binary) (bool,error)) (st ObjectStat, ok bool, e error) {
+	var over,head,body bufferex.Binary
+	ok,e = get(&over,&head,&body)
+	st.Over,st.Head,st.Body = len(over.Bytes()),len(head.Bytes()),len(body.Bytes())
+	over.Free()
+	head.Free()
+	body.Free()
+	return
+}
+
+// Uses Stater, if implemented by s. Otherwise, the object is read using Get, and the expiry is unknown.
+func Stat(s BucketStore, id []byte) (st ObjectStat, ok bool, e error) {
+	if sr,isSr := s.(Stater) ; isSr { return sr.Stat(id) }
+	return statGet(func(overv, head, body *bufferex.Binary) (bool,error) { return s.Get(id,overv,head,body) })
+}
+
+// Uses OverStater, if implemented by s. Otherwise, the object is read using OverGet, and the expiry is unknown.
+func OverStat(s OverStore, bucket []byte, id []byte) (st ObjectStat, ok bool, e error) {
+	if sr,isSr := s.(OverStater) ; isSr { return sr.OverStat(bucket,id) }
+	return statGet(func(overv, head, body *bufferex.Binary) (bool,error) { return s.OverGet(bucket,id,overv,head,body) })
+}
@@ -0,0 +1,98 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bucketstore
+
+import "bytes"
+import "io"
+import "io/ioutil"
+import "time"
+import "github.com/maxymania/fastnntp-polyglot-labs/bufferex"
+
+/*
+Optional interface. Streaming access to the body of an object: overview and head are read as
+usual, the body is returned as a reader, that must be closed.
+*/
+type StreamGetter interface{
+	GetReader(id []byte, overv, head *bufferex.Binary) (body io.ReadCloser, size int64, ok bool, e error)
+}
+
+// Optional interface. Stores an object, whose body (of size bytes) is read from a reader.
+type StreamPutter interface{
+	PutReader(id, overv, head []byte, body io.Reader, size int64, expire time.Time) error
+}
+
+// Optional interface of an OverStore. See StreamGetter.
+type OverStreamGetter interface{
+	OverGetReader(bucket []byte, id []byte, overv, head *bufferex.Binary) (body io.ReadCloser, size int64, ok bool, e error)
+}
+
+// Optional interface of an OverStore. See StreamPutter.
+type OverStreamPutter interface{
+	OverPutReader(bucket []byte, id, overv, head []byte, body io.Reader, size int64, expire time.Time) error
+}
+
+type binaryReader struct{
+	*bytes.Reader
+	bin bufferex.Binary
+}
+func (b *binaryReader) Close() error { b.bin.Free() ; return nil }
+
+func newBinaryReader(bin bufferex.Binary) io.ReadCloser {
+	return &binaryReader{bytes.NewReader(bin.Bytes()),bin}
+}
+
+// Uses StreamGetter, if implemented by s, Get otherwise.
+func GetReader(s BucketStore, id []byte, overv, head *bufferex.Binary) (body io.ReadCloser, size int64, ok bool, e error) {
+	if sg,isSg := s.(StreamGetter) ; isSg { return sg.GetReader(id,overv,head) }
+	var bin bufferex.Binary
+	ok,e = s.Get(id,overv,head,&bin)
+	if e!=nil || !ok { bin.Free() ; return }
+	return newBinaryReader(bin),int64(len(bin.Bytes())),true,nil
+}
+
+// Uses StreamPutter, if implemented by s, Put otherwise.
+func PutReader(s BucketStore, id, overv, head []byte, body io.Reader, size int64, expire time.Time) error {
+	if sp,ok := s.(StreamPutter) ; ok { return sp.PutReader(id,overv,head,body,size,expire) }
+	data,err := ioutil.ReadAll(io.LimitReader(body,size))
+	if err!=nil { return err }
+	if int64(len(data))!=size { return io.ErrUnexpectedEOF }
+	return s.Put(id,overv,head,data,expire)
+}
+
+// Uses OverStreamGetter, if implemented by s, OverGet otherwise.
+func OverGetReader(s OverStore, bucket []byte, id []byte, overv, head *bufferex.Binary) (body io.ReadCloser, size int64, ok bool, e error) {
+	if sg,isSg := s.(OverStreamGetter) ; isSg { return sg.OverGetReader(bucket,id,overv,head) }
+	var bin bufferex.Binary
+	ok,e = s.OverGet(bucket,id,overv,head,&bin)
+	if e!=nil || !ok { bin.Free() ; return }
+	return newBinaryReader(bin),int64(len(bin.Bytes())),true,nil
+}
+
+// Uses OverStreamPutter, if implemented by s, OverPut otherwise.
+func OverPutReader(s OverStore, bucket []byte, id, overv, head []byte, body io.Reader, size int64, expire time.Time) error {
+	if sp,ok := s.(OverStreamPutter) ; ok { return sp.OverPutReader(bucket,id,overv,head,body,size,expire) }
+	data,err := ioutil.ReadAll(io.LimitReader(body,size))
+	if err!=nil { return err }
+	if int64(len(data))!=size { return io.ErrUnexpectedEOF }
+	return s.OverPut(bucket,id,overv,head,data,expire)
+}
@@ -0,0 +1,250 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+/*
+Tiered storage: background migration of articles from hot buckets to cold buckets.
+
+New articles land in the hot tier (see the storage classes in policies_ex). Once they
+reached a certain age, a Tierer copies them into buckets of the cold storage class,
+points the BucketDatabase ID mapping to the copy and deletes the hot copy.
+
+Readers (eg. articlewrap.ArticleDirectBackend) look up the mapping first and fetch the
+article afterwards. To keep the migration invisible to them, the hot copy is deleted only
+after a grace period, so that readers, that saw the old mapping, still find the article.
+
+Limitation: the dayfile backends (dayfile, dayfilemulti) only remove the index entry on
+Delete. The space of a moved article is reclaimed when its dayfile expires, so the free
+storage of the hot bucket does not grow, when articles are moved. Tiering takes load off
+the hot bucket, but it does not make room for new articles before the original expiry.
+*/
+package tiering
+
+import "errors"
+import "io/ioutil"
+import "os"
+import "time"
+import "github.com/vmihailenco/msgpack"
+import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore"
+import "github.com/maxymania/fastnntp-polyglot-labs/bufferex"
+import "github.com/maxymania/fastnntp-polyglot-labs/articlewrap"
+
+var ESelfSubmit = errors.New("Target placed an article into the hot bucket")
+var ENoMapping = errors.New("Tierer.Mapping is required, moved articles would become unreachable")
+
+type Pending struct{
+	_msgpack struct{} `msgpack:",asArray"`
+	Id []byte
+	At int64 // Unix time of the mapping update.
+}
+
+type Progress struct{
+	_msgpack struct{} `msgpack:",asArray"`
+	Moved   int64  // Articles copied into the cold tier.
+	Deleted int64  // Hot copies deleted.
+	Failed  int64  // Articles, that could not be moved (in this pass).
+	Bytes   int64  // Bytes copied.
+	Last    []byte // The ID of the last processed article of the current pass.
+	Pending []Pending // Hot copies, that will be deleted after the grace period.
+}
+
+type idQuery interface{
+	QueryIDMapping(msgid []byte) (bucket bufferex.Binary,err error)
+}
+
+type Tierer struct{
+	Source  bucketstore.BucketStore // The hot bucket. Must implement bucketstore.AgeLister and bucketstore.Deleter.
+	Uuid    string
+	Target  bucketstore.OverStore   // Should implement bucketstore.ClassSubmitter.
+	Class   string                  // The storage class of the cold tier.
+	Mapping articlewrap.IDMappingUpdater // Required. If it is a BucketDatabase, moved articles are recognized on retries.
+	
+	Age   time.Duration // Articles older than Age are moved. Articles of unknown age count as old.
+	Grace time.Duration // Delay between the mapping update and the deletion. Default: 1 minute.
+	
+	Rate      int   // Optional. Max. articles per second.
+	Bandwidth int64 // Optional. Max. bytes per second.
+	
+	Checkpoint      string // Optional. The checkpoint file.
+	CheckpointEvery int    // Default: 100
+	
+	Report func(p *Progress) // Optional. Called after every checkpoint.
+}
+
+func (t *Tierer) load(p *Progress) error {
+	if t.Checkpoint=="" { return nil }
+	data,err := ioutil.ReadFile(t.Checkpoint)
+	if os.IsNotExist(err) { return nil }
+	if err!=nil { return err }
+	return msgpack.Unmarshal(data,p)
+}
+func (t *Tierer) save(p *Progress) error {
+	if t.Report!=nil { t.Report(p) }
+	if t.Checkpoint=="" { return nil }
+	data,err := msgpack.Marshal(p)
+	if err!=nil { return err }
+	tmp := t.Checkpoint+".tmp"
+	err = ioutil.WriteFile(tmp,data,0600)
+	if err!=nil { return err }
+	return os.Rename(tmp,t.Checkpoint)
+}
+
+type limiter struct{
+	start time.Time
+	n, b  int64
+}
+func (t *Tierer) throttle(l *limiter, size int64) {
+	l.n++
+	l.b += size
+	var d time.Duration
+	if t.Rate>0 { d = time.Duration(l.n)*time.Second/time.Duration(t.Rate) }
+	if t.Bandwidth>0 {
+		if bd := time.Duration(l.b*int64(time.Second)/t.Bandwidth) ; bd>d { d = bd }
+	}
+	if d -= time.Since(l.start) ; d>0 { time.Sleep(d) }
+}
+
+func (t *Tierer) moved(id []byte) bool {
+	q,ok := t.Mapping.(idQuery)
+	if !ok { return false }
+	bucket,err := q.QueryIDMapping(id)
+	defer bucket.Free()
+	return err==nil && len(bucket.Bytes())>0 && string(bucket.Bytes())!=t.Uuid
+}
+func (t *Tierer) submit(id, overv, head, body []byte, expire time.Time) (bufferex.Binary,error) {
+	if cs,ok := t.Target.(bucketstore.ClassSubmitter) ; ok { return cs.SubmitClass(t.Class,id,overv,head,body,expire) }
+	return t.Target.Submit(id,overv,head,body,expire)
+}
+func (t *Tierer) move(id []byte, expire time.Time, p *Progress, l *limiter) error {
+	var overv,head,body bufferex.Binary
+	
+	/* Moved in an earlier run, that crashed before the checkpoint. Just delete it. */
+	if t.moved(id) {
+		p.Pending = append(p.Pending,Pending{Id:append([]byte(nil),id...),At:time.Now().Unix()})
+		return nil
+	}
+	
+	ok,err := t.Source.Get(id,&overv,&head,&body)
+	defer overv.Free()
+	defer head.Free()
+	defer body.Free()
+	if err!=nil { return err }
+	if !ok { return nil }
+	
+	bucket,err := t.submit(id,overv.Bytes(),head.Bytes(),body.Bytes(),expire)
+	defer bucket.Free()
+	
+	if err==bucketstore.EExists && len(bucket.Bytes())>0 { err = nil }
+	if err!=nil { p.Failed++ ; return nil }
+	if string(bucket.Bytes())==t.Uuid { return ESelfSubmit }
+	
+	err = t.Mapping.UpdateIDMapping(id,bucket.Bytes())
+	if err!=nil { return err }
+	p.Pending = append(p.Pending,Pending{Id:append([]byte(nil),id...),At:time.Now().Unix()})
+	
+	size := int64(len(overv.Bytes())+len(head.Bytes())+len(body.Bytes()))
+	p.Moved++
+	p.Bytes += size
+	t.throttle(l,size)
+	return nil
+}
+
+// Deletes the hot copies, whose grace period is over.
+func (t *Tierer) purge(p *Progress) error {
+	grace := t.Grace
+	if grace<=0 { grace = time.Minute }
+	due := time.Now().Add(-grace).Unix()
+	del := t.Source.(bucketstore.Deleter)
+	i := 0
+	for _,pe := range p.Pending {
+		if pe.At>due { break }
+		if err := del.Delete(pe.Id) ; err!=nil {
+			p.Pending = p.Pending[i:]
+			return err
+		}
+		p.Deleted++
+		i++
+	}
+	p.Pending = p.Pending[i:]
+	return nil
+}
+
+/*
+Performs (or resumes) one pass over the hot bucket. On error, the progress up to the
+last checkpoint is kept and Run can be called again.
+*/
+func (t *Tierer) Run() (*Progress,error) {
+	if t.Mapping==nil { return nil,ENoMapping }
+	p := new(Progress)
+	if err := t.load(p) ; err!=nil { return nil,err }
+	
+	lst,ok := t.Source.(bucketstore.AgeLister)
+	if !ok { return nil,bucketstore.ENotSupported }
+	if _,ok := t.Source.(bucketstore.Deleter) ; !ok { return nil,bucketstore.ENotSupported }
+	
+	every := t.CheckpointEvery
+	if every<=0 { every = 100 }
+	
+	if err := t.purge(p) ; err!=nil { t.save(p) ; return p,err }
+	p.Failed = 0
+	
+	var ferr error
+	l := &limiter{start:time.Now()}
+	now := time.Now().UTC()
+	n := 0
+	err := lst.ListAge(p.Last,func(id []byte, stored, expire time.Time) bool {
+		if expire.After(now) && (stored.IsZero() || now.Sub(stored)>=t.Age) {
+			ferr = t.move(id,expire,p,l)
+			if ferr!=nil { return false }
+		}
+		p.Last = append(p.Last[:0],id...)
+		n++
+		if (n%every)==0 {
+			ferr = t.purge(p)
+			if ferr==nil { ferr = t.save(p) }
+		}
+		return ferr==nil
+	})
+	if err==nil { err = ferr }
+	if err!=nil { t.save(p) ; return p,err }
+	
+	/* Pass complete. The next one starts over. */
+	p.Last = nil
+	err = t.purge(p)
+	if err==nil { err = t.save(p) }
+	return p,err
+}
+
+/*
+Runs a pass every interval, until stop is closed. Failed passes are resumed from the
+last checkpoint by the next one.
+*/
+func (t *Tierer) Loop(interval time.Duration, stop <-chan struct{}) {
+	tk := time.NewTicker(interval)
+	defer tk.Stop()
+	for {
+		t.Run()
+		select {
+		case <-stop: return
+		case <-tk.C:
+		}
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+/*
+A command line client for the admin API of a bucket router (see remote.BucketRouter).
+
+	bucketadm [-addr host:port] [-token secret] buckets
+	bucketadm [-addr host:port] [-token secret] members
+	bucketadm [-addr host:port] -token secret expire <bucket> <YYYY-MM-DD>
+	bucketadm [-addr host:port] -token secret reset <bucket>
+*/
+package main
+
+import "bytes"
+import "encoding/json"
+import "flag"
+import "fmt"
+import "os"
+import "time"
+import "github.com/valyala/fasthttp"
+import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore/remote"
+
+var addr = flag.String("addr","127.0.0.1:8080","address of the bucket router")
+var token = flag.String("token",os.Getenv("BUCKETADM_TOKEN"),"admin token (default $BUCKETADM_TOKEN)")
+
+func usage() {
+	fmt.Fprintln(os.Stderr,"usage: bucketadm [flags] buckets|members|expire <bucket> <YYYY-MM-DD>|reset <bucket>")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr,"bucketadm:",err)
+	os.Exit(1)
+}
+
+func do(method, uri string) []byte {
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+	req.Header.SetMethod(method)
+	req.SetRequestURI("http://"+*addr+uri)
+	if *token!="" { req.Header.Set("X-Admin-Token",*token) }
+	err := fasthttp.DoTimeout(req,resp,time.Second*30)
+	if err!=nil { fail(err) }
+	switch resp.StatusCode() {
+	case fasthttp.StatusOK, fasthttp.StatusNoContent:
+	default: fail(fmt.Errorf("%d %s",resp.StatusCode(),bytes.TrimSpace(resp.Body())))
+	}
+	return append([]byte(nil),resp.Body()...)
+}
+
+func show(data []byte) {
+	var buf bytes.Buffer
+	if json.Indent(&buf,data,"","  ")!=nil { os.Stdout.Write(data) ; return }
+	buf.WriteByte('\n')
+	buf.WriteTo(os.Stdout)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	args := flag.Args()
+	if len(args)==0 { usage() }
+	switch args[0] {
+	case "buckets","members":
+		if len(args)!=1 { usage() }
+		show(do("GET","/api.admin/"+args[0]))
+	case "expire":
+		if len(args)!=3 { usage() }
+		t,err := time.ParseInLocation("2006-01-02",args[2],time.UTC)
+		if err!=nil { fail(err) }
+		do("POST","/api.admin/expire/"+args[1]+"/"+t.Format(remote.URLDate))
+	case "reset":
+		if len(args)!=2 { usage() }
+		do("POST","/api.admin/reset/"+args[1])
+	default:
+		usage()
+	}
+}
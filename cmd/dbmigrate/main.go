@@ -0,0 +1,317 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+
+/*
+Copies the groups and the mappings from one BucketDatabase and group database implementation
+to another.
+
+	dbmigrate -from kind:source -to kind:source [-checkpoint file] [-batch n] [-copy] [-verify=false]
+
+The kinds are:
+	sqldb:postgres://...      articlewrap/sqldb and groupdb/semigroupdb
+	combined:postgres://...   groupdb/combined_db
+	bolt:/path/to/file        articlewrap/boltdb (mappings only)
+
+The groups (description, status and high-water mark), the ID mappings and the group mappings are
+copied in this order, in batches. The SQL models of the target are installed (or upgraded) first;
+tables created before schema versioning are adopted as version 1.
+After every batch, the position is saved to the checkpoint file, so that an interrupted migration
+continues where it stopped. At the end, the entries of both sides are counted and compared.
+
+The source must not be modified while the migration runs.
+*/
+package main
+
+import "database/sql"
+import "encoding/json"
+import "flag"
+import "fmt"
+import "io/ioutil"
+import "os"
+import "strings"
+import "time"
+import _ "github.com/lib/pq"
+import "github.com/maxymania/fastnntp-polyglot-labs/articlewrap"
+import "github.com/maxymania/fastnntp-polyglot-labs/articlewrap/boltdb"
+import "github.com/maxymania/fastnntp-polyglot-labs/articlewrap/sqldb"
+import "github.com/maxymania/fastnntp-polyglot-labs/groupdb"
+import "github.com/maxymania/fastnntp-polyglot-labs/groupdb/combined_db"
+import "github.com/maxymania/fastnntp-polyglot-labs/groupdb/semigroupdb"
+import "github.com/maxymania/fastnntp-polyglot-labs/util/sqlutil"
+
+var from = flag.String("from","","source (kind:source)")
+var to = flag.String("to","","target (kind:source)")
+var cpFile = flag.String("checkpoint","","checkpoint file (default: none)")
+var batch = flag.Int("batch",1000,"entries per batch")
+var useCopy = flag.Bool("copy",false,"use COPY to insert into a sqldb target")
+var verify = flag.Bool("verify",true,"compare the counts at the end")
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr,"dbmigrate:",err)
+	os.Exit(1)
+}
+
+type endpoint struct{
+	name   string
+	maps   articlewrap.BucketDatabase
+	groups interface{} // groupdb.GroupExporter and/or groupdb.GroupImporter, or nil.
+	close  func()
+}
+
+func openSQL(dsn string) *sql.DB {
+	db,err := sql.Open("postgres",dsn)
+	if err==nil { err = db.Ping() }
+	if err!=nil { fail(err) }
+	return db
+}
+
+func install(db *sql.DB, schemas ...*sqlutil.Schema) {
+	for _,s := range schemas {
+		if _,err := s.Migrate(db,sqlutil.PgDialect,nil) ; err!=nil { fail(err) }
+	}
+}
+
+func open(spec string, target bool) *endpoint {
+	i := strings.IndexByte(spec,':')
+	if i<0 { fail(fmt.Errorf("invalid endpoint %q, expected kind:source",spec)) }
+	ep := &endpoint{name:spec[:i]}
+	src := spec[i+1:]
+	switch ep.name {
+	case "sqldb":
+		db := openSQL(src)
+		if target { install(db,sqldb.Schema,semigroupdb.Schema) }
+		m := &sqldb.Base{DB:db,Copy:*useCopy}
+		ep.maps,ep.groups = m,&semigroupdb.Base{DB:db}
+		ep.close = func() { m.Close() ; db.Close() }
+	case "combined":
+		db := openSQL(src)
+		if target { install(db,combined_db.Schema) }
+		b := &combined_db.Base{DB:db}
+		ep.maps,ep.groups = b,b
+		ep.close = func() { db.Close() }
+	case "bolt":
+		b,err := boltdb.Open(src)
+		if err!=nil { fail(err) }
+		ep.maps = b
+		ep.close = func() { b.DB.Close() }
+	default:
+		fail(fmt.Errorf("unknown kind %q",ep.name))
+	}
+	return ep
+}
+
+const (
+	phaseGroups = "groups"
+	phaseIDs    = "ids"
+	phaseMaps   = "groupmaps"
+	phaseDone   = "done"
+)
+
+// The position of the migration. Msgid, Group and Num are the last copied keys of the current phase.
+type checkpoint struct{
+	Phase  string
+	Msgid  []byte
+	Group  []byte
+	Num    int64
+	Counts map[string]int64
+}
+
+func (cp *checkpoint) load() {
+	cp.Phase = phaseGroups
+	cp.Counts = make(map[string]int64)
+	if *cpFile=="" { return }
+	data,err := ioutil.ReadFile(*cpFile)
+	if os.IsNotExist(err) { return }
+	if err==nil { err = json.Unmarshal(data,cp) }
+	if err!=nil { fail(err) }
+	if cp.Counts==nil { cp.Counts = make(map[string]int64) }
+}
+
+// Writes the checkpoint into a temporary file, which then replaces the checkpoint file.
+func (cp *checkpoint) save() {
+	if *cpFile=="" { return }
+	data,err := json.Marshal(cp)
+	if err==nil { err = ioutil.WriteFile(*cpFile+".tmp",data,0600) }
+	if err==nil { err = os.Rename(*cpFile+".tmp",*cpFile) }
+	if err!=nil { fail(err) }
+}
+
+func (cp *checkpoint) next(phase string) {
+	cp.Phase = phase
+	cp.Msgid,cp.Group,cp.Num = nil,nil,0
+	cp.save()
+}
+
+func progress(cp *checkpoint) {
+	fmt.Printf("%s: %d\n",cp.Phase,cp.Counts[cp.Phase])
+}
+
+/*
+Copies the groups. There is no position within this phase: as the import overwrites existing
+groups, it is simply repeated after an interruption.
+*/
+func copyGroups(src, dst *endpoint, cp *checkpoint) {
+	ex,ok1 := src.groups.(groupdb.GroupExporter)
+	im,ok2 := dst.groups.(groupdb.GroupImporter)
+	if !ok1 || !ok2 {
+		fmt.Fprintln(os.Stderr,"dbmigrate: groups are not supported by",src.name,"or",dst.name,"- skipped")
+		return
+	}
+	list := make([]groupdb.Group,0,*batch)
+	n := int64(0)
+	var err error
+	flush := func() bool {
+		if err = im.ImportGroups(list) ; err!=nil { return false }
+		n += int64(len(list))
+		list = list[:0]
+		return true
+	}
+	e := ex.ExportGroups(func(g *groupdb.Group) bool {
+		c := *g
+		c.Name = append([]byte(nil),g.Name...)
+		if g.Descr!=nil { c.Descr = append([]byte{},g.Descr...) }
+		list = append(list,c)
+		if len(list)<cap(list) { return true }
+		return flush()
+	})
+	if err==nil { err = e }
+	if err==nil && len(list)>0 { flush() }
+	if err!=nil { fail(err) }
+	cp.Counts[phaseGroups] = n
+	progress(cp)
+}
+
+func copyIDs(src, dst *endpoint, cp *checkpoint) {
+	ex,ok1 := src.maps.(articlewrap.IDMappingLister)
+	im,ok2 := dst.maps.(articlewrap.MappingImporter)
+	if !ok1 || !ok2 { fail(fmt.Errorf("ID mappings can't be copied from %s to %s",src.name,dst.name)) }
+	list := make([]articlewrap.IDMapping,0,*batch)
+	var err error
+	flush := func() bool {
+		if err = im.ImportIDMappings(list) ; err!=nil { return false }
+		cp.Msgid = list[len(list)-1].Msgid
+		cp.Counts[phaseIDs] += int64(len(list))
+		cp.save()
+		progress(cp)
+		list = list[:0]
+		return true
+	}
+	e := ex.ListIDMappings(cp.Msgid,func(msgid, bucket []byte, expire time.Time) bool {
+		list = append(list,articlewrap.IDMapping{
+			Msgid: append([]byte(nil),msgid...),
+			Bucket: append([]byte(nil),bucket...),
+			Expire: expire,
+		})
+		if len(list)<cap(list) { return true }
+		return flush()
+	})
+	if err==nil { err = e }
+	if err==nil && len(list)>0 { flush() }
+	if err!=nil { fail(err) }
+}
+
+func copyGroupMappings(src, dst *endpoint, cp *checkpoint) {
+	ex,ok1 := src.maps.(articlewrap.GroupMappingLister)
+	im,ok2 := dst.maps.(articlewrap.MappingImporter)
+	if !ok1 || !ok2 { fail(fmt.Errorf("group mappings can't be copied from %s to %s",src.name,dst.name)) }
+	list := make([]articlewrap.GroupMapping,0,*batch)
+	var err error
+	flush := func() bool {
+		if err = im.ImportGroupMappings(list) ; err!=nil { return false }
+		last := &list[len(list)-1]
+		cp.Group,cp.Num = last.Group,last.Num
+		cp.Counts[phaseMaps] += int64(len(list))
+		cp.save()
+		progress(cp)
+		list = list[:0]
+		return true
+	}
+	e := ex.ListGroupMappings(cp.Group,cp.Num,func(group []byte, num int64, msgid []byte, expire time.Time) bool {
+		list = append(list,articlewrap.GroupMapping{
+			Group: append([]byte(nil),group...),
+			Num: num,
+			Msgid: append([]byte(nil),msgid...),
+			Expire: expire,
+		})
+		if len(list)<cap(list) { return true }
+		return flush()
+	})
+	if err==nil { err = e }
+	if err==nil && len(list)>0 { flush() }
+	if err!=nil { fail(err) }
+}
+
+// Counts the groups, ID mappings and group mappings of an endpoint.
+func count(ep *endpoint) (c [3]int64, err error) {
+	if ex,ok := ep.groups.(groupdb.GroupExporter) ; ok {
+		err = ex.ExportGroups(func(*groupdb.Group) bool { c[0]++ ; return true })
+		if err!=nil { return }
+	}
+	if l,ok := ep.maps.(articlewrap.IDMappingLister) ; ok {
+		err = l.ListIDMappings(nil,func([]byte, []byte, time.Time) bool { c[1]++ ; return true })
+		if err!=nil { return }
+	}
+	if l,ok := ep.maps.(articlewrap.GroupMappingLister) ; ok {
+		err = l.ListGroupMappings(nil,0,func([]byte, int64, []byte, time.Time) bool { c[2]++ ; return true })
+	}
+	return
+}
+
+func main() {
+	flag.Parse()
+	if *batch<1 { *batch = 1 }
+	src := open(*from,false)
+	defer src.close()
+	dst := open(*to,true)
+	defer dst.close()
+	
+	cp := new(checkpoint)
+	cp.load()
+	if cp.Phase==phaseGroups {
+		copyGroups(src,dst,cp)
+		cp.next(phaseIDs)
+	}
+	if cp.Phase==phaseIDs {
+		copyIDs(src,dst,cp)
+		cp.next(phaseMaps)
+	}
+	if cp.Phase==phaseMaps {
+		copyGroupMappings(src,dst,cp)
+		cp.next(phaseDone)
+	}
+	
+	if !*verify { return }
+	cs,err := count(src)
+	if err!=nil { fail(err) }
+	cd,err := count(dst)
+	if err!=nil { fail(err) }
+	ok := true
+	for i,name := range []string{"groups","ID mappings","group mappings"} {
+		fmt.Printf("%-15s source: %10d target: %10d\n",name,cs[i],cd[i])
+		if i==0 && (src.groups==nil || dst.groups==nil) { continue }
+		if cs[i]!=cd[i] { ok = false }
+	}
+	if !ok { fail(fmt.Errorf("counts differ (was the target empty? was the source modified?)")) }
+}
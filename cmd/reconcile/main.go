@@ -0,0 +1,137 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+/*
+Cross-checks a BucketDatabase (PostgreSQL, see articlewrap/sqldb) against the buckets of a
+bucket router, and optionally repairs the inconsistencies (see articlewrap/reconcile).
+
+	reconcile -dsn postgres://... [-addr host:port] [-buckets uuid,uuid] [-dangling report|remove] [-unindexed report|reindex|remove] [-renumber] [-rate n] [-min-age d] [-every d]
+
+If -buckets is omitted, all buckets known to the router are scanned (requires -token).
+With -renumber, re-indexed articles are also numbered again in their groups (requires the
+semigroupdb model, see groupdb/semigroupdb); otherwise only their ID mapping is restored.
+With -every, the check runs as a background job, repeated in the given interval.
+*/
+package main
+
+import "database/sql"
+import "encoding/json"
+import "flag"
+import "fmt"
+import "os"
+import "strings"
+import "time"
+import _ "github.com/lib/pq"
+import "github.com/valyala/fasthttp"
+import "github.com/maxymania/fastnntp-polyglot-labs/articlewrap/reconcile"
+import "github.com/maxymania/fastnntp-polyglot-labs/articlewrap/sqldb"
+import "github.com/maxymania/fastnntp-polyglot-labs/bucketstore/remote"
+import "github.com/maxymania/fastnntp-polyglot-labs/groupdb/semigroupdb"
+
+var dsn = flag.String("dsn","","PostgreSQL data source name")
+var addr = flag.String("addr","127.0.0.1:8080","address of the bucket router")
+var token = flag.String("token",os.Getenv("BUCKETADM_TOKEN"),"admin token, to list the buckets (default $BUCKETADM_TOKEN)")
+var buckets = flag.String("buckets","","comma separated list of buckets to scan (default: all)")
+var dangling = flag.String("dangling","report","action on dangling mappings: report|remove")
+var unindexed = flag.String("unindexed","report","action on unindexed articles: report|reindex|remove")
+var renumber = flag.Bool("renumber",false,"number re-indexed articles in their groups (requires semigroupdb)")
+var rate = flag.Int("rate",0,"max. checks per second (0 = unlimited)")
+var minAge = flag.Duration("min-age",10*time.Minute,"skip objects younger than this")
+var every = flag.Duration("every",0,"repeat in this interval (0 = run once)")
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr,"reconcile:",err)
+	os.Exit(1)
+}
+
+func action(s string, allowed ...reconcile.Action) reconcile.Action {
+	var a reconcile.Action
+	switch s {
+	case "report": a = reconcile.ReportOnly
+	case "reindex": a = reconcile.Reindex
+	case "remove": a = reconcile.Remove
+	default: fail(fmt.Errorf("unknown action %q",s))
+	}
+	for _,b := range allowed {
+		if a==b { return a }
+	}
+	fail(fmt.Errorf("action %q not allowed here",s))
+	panic("unreachable")
+}
+
+// Lists the buckets through the admin API of the router.
+func listBuckets() (list [][]byte) {
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+	req.SetRequestURI("http://"+*addr+"/api.admin/buckets")
+	if *token!="" { req.Header.Set("X-Admin-Token",*token) }
+	if err := fasthttp.DoTimeout(req,resp,time.Second*30) ; err!=nil { fail(err) }
+	if resp.StatusCode()!=fasthttp.StatusOK { fail(fmt.Errorf("listing buckets: status %d",resp.StatusCode())) }
+	var infos []remote.BucketInfo
+	if err := json.Unmarshal(resp.Body(),&infos) ; err!=nil { fail(err) }
+	for _,bi := range infos { list = append(list,[]byte(bi.Uuid)) }
+	return
+}
+
+func show(res *reconcile.Result, err error) {
+	fmt.Printf("mappings=%d objects=%d dangling=%d unindexed=%d repaired=%d failed=%d skipped=%d\n",
+		res.Mappings,res.Objects,res.Dangling,res.Unindexed,res.Repaired,res.Failed,res.Skipped)
+	if err!=nil { fmt.Fprintln(os.Stderr,"reconcile:",err) }
+}
+
+func main() {
+	flag.Parse()
+	if *dsn=="" { flag.Usage() ; os.Exit(2) }
+	db,err := sql.Open("postgres",*dsn)
+	if err!=nil { fail(err) }
+	defer db.Close()
+	
+	r := &reconcile.Reconciler{
+		Bdb: &sqldb.Base{DB:db},
+		Store: remote.NewMultiClient(&fasthttp.HostClient{Addr: *addr}),
+		Dangling: action(*dangling,reconcile.ReportOnly,reconcile.Remove),
+		Unindexed: action(*unindexed,reconcile.ReportOnly,reconcile.Reindex,reconcile.Remove),
+		MinAge: *minAge,
+		Rate: *rate,
+		Report: func(id, bucket []byte, problem error) {
+			fmt.Printf("%s\t%s\t%s\n",problem,bucket,id)
+		},
+	}
+	if *renumber { r.Groups = &semigroupdb.PgBase{Base: semigroupdb.Base{DB: db}} }
+	if *buckets!="" {
+		for _,b := range strings.Split(*buckets,",") { r.Buckets = append(r.Buckets,[]byte(b)) }
+	} else {
+		r.Buckets = listBuckets()
+	}
+	
+	if *every>0 {
+		r.Loop(*every,nil,show)
+		return
+	}
+	res,err := r.Run()
+	show(res,err)
+	if err!=nil { os.Exit(1) }
+}
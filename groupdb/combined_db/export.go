@@ -0,0 +1,113 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package combined_db
+
+import "time"
+import "github.com/maxymania/fastnntp-polyglot-labs/articlewrap"
+import "github.com/maxymania/fastnntp-polyglot-labs/articlewrap/sqldb"
+import "github.com/maxymania/fastnntp-polyglot-labs/groupdb"
+import "github.com/maxymania/fastnntp-polyglot-labs/util/sqlutil"
+
+/*
+The mapping tables are the same as those of articlewrap/sqldb, so the export and import
+of mappings is delegated to it.
+*/
+func (b *Base) mappings() *sqldb.Base { return &sqldb.Base{DB:b.DB} }
+
+// Implements articlewrap.IDMappingLister.
+func (b *Base) ListIDMappings(after []byte, targ func(msgid, bucket []byte, expire time.Time) bool) error {
+	m := b.mappings()
+	defer m.Close()
+	return m.ListIDMappings(after,targ)
+}
+// Implements articlewrap.GroupMappingLister.
+func (b *Base) ListGroupMappings(group []byte, num int64, targ func(group []byte, num int64, msgid []byte, expire time.Time) bool) error {
+	m := b.mappings()
+	defer m.Close()
+	return m.ListGroupMappings(group,num,targ)
+}
+// Implements articlewrap.MappingImporter.
+func (b *Base) ImportIDMappings(m []articlewrap.IDMapping) error {
+	return b.mappings().ImportIDMappings(m)
+}
+// Implements articlewrap.MappingImporter.
+func (b *Base) ImportGroupMappings(m []articlewrap.GroupMapping) error {
+	return b.mappings().ImportGroupMappings(m)
+}
+
+/*
+Implements groupdb.GroupExporter. Latest is taken from the "ganlst" counter.
+*/
+func (b *Base) ExportGroups(targ func(g *groupdb.Group) bool) error {
+	rows,err := b.DB.Query(`
+	SELECT
+		COALESCE(a.ngrp,g.ngrp),g.dscr,COALESCE(a.status,0),COALESCE(a.ganlst,0)
+	FROM
+		newsactive a FULL OUTER JOIN newsgroups g ON a.ngrp=g.ngrp
+	;`)
+	if err!=nil { return err }
+	defer rows.Close()
+	var g groupdb.Group
+	var status uint
+	scn := []interface{}{&g.Name,&g.Descr,&status,&g.Latest}
+	for rows.Next() {
+		g.Descr = nil
+		if err = rows.Scan(scn...) ; err!=nil { return err }
+		g.Status = byte(status)
+		if !targ(&g) { return nil }
+	}
+	return rows.Err()
+}
+
+/*
+Implements groupdb.GroupImporter. The "ganlst" counter starts at 1, so Latest is raised to 1.
+*/
+func (b *Base) ImportGroups(groups []groupdb.Group) (err error) {
+	tx,err := b.DB.Begin()
+	if err!=nil { return }
+	defer func() {
+		if err!=nil { tx.Rollback() ; return }
+		err = tx.Commit()
+	}()
+	for _,g := range groups {
+		if g.Status!=0 {
+			latest := g.Latest
+			if latest<1 { latest = 1 }
+			err = sqlutil.PgDialect.Upsert(tx,
+				`UPDATE newsactive SET ganlst=$1,status=$2 WHERE ngrp=$3;`,
+				`INSERT INTO newsactive (ngrp,ganlst,status) VALUES ($1,$2,$3);`,
+				[]interface{}{latest,int(g.Status),g.Name},[]interface{}{g.Name,latest,int(g.Status)})
+			if err!=nil { return }
+		}
+		if g.Descr!=nil {
+			err = sqlutil.PgDialect.Upsert(tx,
+				`UPDATE newsgroups SET dscr=$1 WHERE ngrp=$2;`,
+				`INSERT INTO newsgroups (ngrp,dscr) VALUES ($1,$2);`,
+				[]interface{}{g.Descr,g.Name},[]interface{}{g.Name,g.Descr})
+			if err!=nil { return }
+		}
+	}
+	return
+}
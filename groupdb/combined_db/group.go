@@ -62,7 +62,7 @@ func (b *Base) GroupAdmPutStatus(group []byte, status byte) {
 
 func (b *Base) AdmPutDescr(group []byte, descr []byte) {
 	_,err := b.DB.Exec(`INSERT INTO newsgroups (ngrp,dscr) VALUES ($1,$2);`,group,descr)
-	if err!=nil { b.DB.Exec(`UPDATE newsgroups SET descr=$1 WHERE ngrp=$2;`     ,descr,group) }
+	if err!=nil { b.DB.Exec(`UPDATE newsgroups SET dscr=$1 WHERE ngrp=$2;`     ,descr,group) }
 }
 func (b *Base) AdmPutStatus(group []byte, status byte) {
 	_,err := b.DB.Exec(`INSERT INTO newsactive (ngrp,ganlst,status) VALUES ($1,1,$2);`,group,int(status))
@@ -89,6 +89,7 @@ func (b *Base) GroupHeadInsert(groups [][]byte, buf []int64) (nums []int64, e er
 	return
 }
 
+// Decrements the latest number of each group, if it is still the number allocated by GroupHeadInsert.
 func (b *Base) GroupHeadRevert(groups [][]byte, nums []int64) error {
 	for i,group := range groups {
 		b.DB.Exec(`
@@ -97,7 +98,7 @@ func (b *Base) GroupHeadRevert(groups [][]byte, nums []int64) error {
 		SET
 			ganlst = ganlst - 1
 		WHERE
-			ganlst = $1,
+			ganlst = $1 AND
 			ngrp = $2
 		;`,nums[i],group)
 	}
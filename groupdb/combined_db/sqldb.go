@@ -26,7 +26,6 @@ package combined_db
 import "fmt"
 import "database/sql"
 import "text/template"
-import "bytes"
 import "time"
 import "github.com/maxymania/fastnntp-polyglot-labs/bufferex"
 import "github.com/maxymania/fastnntp-polyglot-labs/util/sqlutil"
@@ -99,11 +98,21 @@ type Base struct{
 	DB *sql.DB
 }
 
+/* This model uses materialized views and is for PostgreSQL only. */
+var Schema = &sqlutil.Schema{
+	Model: "combined_db",
+	Probe: "newsactive",
+	Migrations: []sqlutil.Migration{
+		{Version: 1, Name: "create tables", SQL: createTables},
+	},
+	Dialects: []*sqlutil.Dialect{sqlutil.PgDialect},
+}
+
+func (b *Base) SqlSchema() *sqlutil.Schema { return Schema }
+
 func (b *Base) CreateSqlModel(d *sqlutil.Dialect) error {
-	if d!=sqlutil.PgDialect { return fmt.Errorf("Support only PostgreSQL") }
-	buf := new(bytes.Buffer)
-	createTables.Execute(buf, d)
-	_,err := b.DB.Exec(buf.String())
+	if d.Def()!=sqlutil.PgDialect { return fmt.Errorf("Support only PostgreSQL") }
+	_,err := Schema.Migrate(b.DB,d,nil)
 	return err
 }
 
@@ -115,6 +124,34 @@ func (b *Base) InsertIDMapping(msgid, bucket []byte, expire time.Time) error {
 	_,err := b.DB.Exec(`INSERT INTO msgidbkt (msgid,bucket,expir) VALUES ($1,$2,$3);`,msgid,bucket,expire)
 	return err
 }
+func (b *Base) UpdateIDMapping(msgid, bucket []byte) error {
+	_,err := b.DB.Exec(`UPDATE msgidbkt SET bucket=$1 WHERE msgid=$2;`,bucket,msgid)
+	return err
+}
+// Implements articlewrap.MappingInserter.
+func (b *Base) InsertMappings(msgid, bucket []byte, groups [][]byte, nums []int64, expire time.Time) (err error) {
+	tx,err := b.DB.Begin()
+	if err!=nil { return }
+	defer func() {
+		if err!=nil { tx.Rollback() ; return }
+		err = tx.Commit()
+	}()
+	_,err = tx.Exec(`INSERT INTO msgidbkt (msgid,bucket,expir) VALUES ($1,$2,$3);`,msgid,bucket,expire)
+	if err!=nil { return }
+	for i,group := range groups {
+		_,err = tx.Exec(`INSERT INTO ngrpnumvalue (ngrp,mnum,msgid,expir) VALUES ($1,$2,$3,$4);`,group,nums[i],msgid,expire)
+		if err!=nil { return }
+	}
+	return
+}
+func (b *Base) DeleteGroupMapping(group []byte, num int64, msgid []byte) error {
+	_,err := b.DB.Exec(`DELETE FROM ngrpnumvalue WHERE ngrp=$1 AND mnum=$2 AND msgid=$3;`,group,num,msgid)
+	return err
+}
+func (b *Base) DeleteIDMapping(msgid []byte) error {
+	_,err := b.DB.Exec(`DELETE FROM msgidbkt WHERE msgid=$1;`,msgid)
+	return err
+}
 
 func (b *Base) QueryGroupMapping(group []byte, num int64) (msgid, bucket bufferex.Binary,err error) {
 	var res *sql.Rows
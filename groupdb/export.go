@@ -0,0 +1,46 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package groupdb
+
+// A newsgroup, as exchanged between group databases (see GroupExporter and GroupImporter).
+type Group struct{
+	Name   []byte
+	Descr  []byte // nil, if the group has no description.
+	Status byte   // 0, if the group has a description only.
+	Latest int64  // The last allocated article number (the high-water mark).
+}
+
+// Implemented by group databases, that can enumerate their groups, until targ returns false.
+type GroupExporter interface{
+	ExportGroups(targ func(g *Group) bool) error
+}
+
+/*
+Implemented by group databases, that can import groups exported by another group database.
+Each call is atomic. Existing groups are overwritten.
+*/
+type GroupImporter interface{
+	ImportGroups(g []Group) error
+}
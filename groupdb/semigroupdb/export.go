@@ -0,0 +1,95 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package semigroupdb
+
+import "database/sql"
+import "github.com/maxymania/fastnntp-polyglot-labs/groupdb"
+
+// Implements groupdb.GroupExporter.
+func (b *Base) ExportGroups(targ func(g *groupdb.Group) bool) error {
+	rows,err := b.Dialect.Query(b.DB,`
+	SELECT
+		m.ngrp,s.descr,m.status,m.latest
+	FROM
+		ngrpcnt m LEFT JOIN ngrpstatic s ON s.ngrp=m.ngrp
+	;`)
+	if err!=nil { return err }
+	ok,err := scanGroups(rows,targ)
+	if err!=nil || !ok { return err }
+	
+	/* Groups with a description only. */
+	rows,err = b.Dialect.Query(b.DB,`
+	SELECT
+		s.ngrp,s.descr,0,0
+	FROM
+		ngrpstatic s LEFT JOIN ngrpcnt m ON s.ngrp=m.ngrp
+	WHERE
+		m.ngrp IS NULL
+	;`)
+	if err!=nil { return err }
+	_,err = scanGroups(rows,targ)
+	return err
+}
+
+func scanGroups(rows *sql.Rows, targ func(g *groupdb.Group) bool) (bool, error) {
+	defer rows.Close()
+	var g groupdb.Group
+	var status uint
+	scn := []interface{}{&g.Name,&g.Descr,&status,&g.Latest}
+	for rows.Next() {
+		g.Descr = nil
+		if err := rows.Scan(scn...) ; err!=nil { return false,err }
+		g.Status = byte(status)
+		if !targ(&g) { return false,nil }
+	}
+	return true,rows.Err()
+}
+
+// Implements groupdb.GroupImporter.
+func (b *Base) ImportGroups(groups []groupdb.Group) (err error) {
+	tx,err := b.DB.Begin()
+	if err!=nil { return }
+	defer func() {
+		if err!=nil { tx.Rollback() ; return }
+		err = tx.Commit()
+	}()
+	for _,g := range groups {
+		if g.Status!=0 {
+			err = b.Dialect.Upsert(tx,
+				`UPDATE ngrpcnt SET latest=$1,status=$2 WHERE ngrp=$3;`,
+				`INSERT INTO ngrpcnt (ngrp,latest,status) VALUES ($1,$2,$3);`,
+				[]interface{}{g.Latest,int(g.Status),g.Name},[]interface{}{g.Name,g.Latest,int(g.Status)})
+			if err!=nil { return }
+		}
+		if g.Descr!=nil {
+			err = b.Dialect.Upsert(tx,
+				`UPDATE ngrpstatic SET descr=$1 WHERE ngrp=$2;`,
+				`INSERT INTO ngrpstatic (ngrp,descr) VALUES ($1,$2);`,
+				[]interface{}{g.Descr,g.Name},[]interface{}{g.Name,g.Descr})
+			if err!=nil { return }
+		}
+	}
+	return
+}
@@ -102,7 +102,8 @@ GROUP BY
 `
 
 type Base struct{
-	DB *sql.DB
+	DB      *sql.DB
+	Dialect *sqlutil.Dialect // nil = PostgreSQL
 }
 
 /* This is for PostgreSQL only. This must not be used with any other Database. */
@@ -110,17 +111,27 @@ type PgBase struct{
 	Base
 }
 
+/*
+The "semigroupdb" model. It requires the "sqldb" model (articlewrap/sqldb) to be installed first.
+*/
+var Schema = &sqlutil.Schema{
+	Model: "semigroupdb",
+	Probe: "ngrpcnt",
+	Migrations: []sqlutil.Migration{
+		{Version: 1, Name: "create tables", SQL: createTables},
+	},
+}
+
+func (b *Base) SqlSchema() *sqlutil.Schema { return Schema }
+
 func (b *Base) CreateSqlModel(d *sqlutil.Dialect) error {
-	buf := new(bytes.Buffer)
-	createTables.Execute(buf, d)
-	_,err := b.DB.Exec(buf.String())
+	_,err := Schema.Migrate(b.DB,d,nil)
 	return err
 }
 func (b *Base) CreateTables(d *Dialect) error {
 	buf := new(bytes.Buffer)
 	createTables.Execute(buf, d)
-	_,err := b.DB.Exec(buf.String())
-	return err
+	return b.Dialect.ExecScript(b.DB,buf.String())
 }
 
 /* This must be used to implement GroupHeadCache. */
@@ -132,7 +143,7 @@ type AuthBase struct {
 /* No */
 func (b *AuthBase) GroupHeadFilter(groups [][]byte) ([][]byte, error) {
 	var status byte
-	stm,err := b.DB.Prepare(`
+	stm,err := b.Dialect.Prepare(b.DB,`
 	SELECT
 		n.status
 	FROM
@@ -167,7 +178,7 @@ func (b *AuthBase) GroupHeadFilter(groups [][]byte) ([][]byte, error) {
 
 func (b *Base) GroupHeadFilterWithAuth(rank postauth.AuthRank,groups [][]byte) ([][]byte,error) {
 	var status byte
-	stm,err := b.DB.Prepare(`
+	stm,err := b.Dialect.Prepare(b.DB,`
 	SELECT
 		n.status
 	FROM
@@ -194,14 +205,18 @@ func (b *Base) GroupHeadFilterWithAuth(rank postauth.AuthRank,groups [][]byte) (
 }
 
 func (b *Base) GroupAdmPutDescr(group []byte, descr []byte) {
-	_,err := b.DB.Exec(`INSERT INTO ngrpstatic (ngrp,descr) VALUES ($1,$2);`,group,descr)
-	if err!=nil { b.DB.Exec(`UPDATE ngrpstatic SET descr=$1 WHERE ngrp=$2;`     ,descr,group) }
+	_,err := b.Dialect.Exec(b.DB,`INSERT INTO ngrpstatic (ngrp,descr) VALUES ($1,$2);`,group,descr)
+	if err!=nil { b.Dialect.Exec(b.DB,`UPDATE ngrpstatic SET descr=$1 WHERE ngrp=$2;`     ,descr,group) }
 }
 func (b *Base) GroupAdmPutStatus(group []byte, status byte) {
-	_,err := b.DB.Exec(`INSERT INTO ngrpcnt (ngrp,latest,status) VALUES ($1,0,$2);`,group,int(status))
-	if err!=nil { b.DB.Exec(`UPDATE ngrpcnt SET status=$1 WHERE ngrp=$2;`,int(status),group) }
+	_,err := b.Dialect.Exec(b.DB,`INSERT INTO ngrpcnt (ngrp,latest,status) VALUES ($1,0,$2);`,group,int(status))
+	if err!=nil { b.Dialect.Exec(b.DB,`UPDATE ngrpcnt SET status=$1 WHERE ngrp=$2;`,int(status),group) }
 }
 
+/*
+Allocates the next number of each group within one transaction. If the dialect supports
+UPDATE ... RETURNING, each number is allocated with a single statement.
+*/
 func (b *Base) GroupHeadInsert(groups [][]byte, buf []int64) (nums []int64, e error) {
 	{
 		l := len(groups)
@@ -209,6 +224,7 @@ func (b *Base) GroupHeadInsert(groups [][]byte, buf []int64) (nums []int64, e er
 		buf = buf[:l]
 		nums = buf
 	}
+	returning := b.Dialect.Def().Returning
 	tx,err := b.DB.Begin()
 	if err!=nil { return nil,err }
 	defer func() {
@@ -218,12 +234,23 @@ func (b *Base) GroupHeadInsert(groups [][]byte, buf []int64) (nums []int64, e er
 		}
 		
 		err := tx.Commit()
-		if err==nil {
+		if err!=nil {
 			e = err
 		}
 	}()
 	for i,group := range groups {
-		tx.Exec(`
+		if returning {
+			e = b.Dialect.QueryRow(tx,`
+			UPDATE	ngrpcnt
+			SET	latest = latest + 1
+			WHERE	ngrp = $1
+			RETURNING
+				latest;
+			`,group).Scan(&buf[i])
+			if e!=nil { return }
+			continue
+		}
+		_,e = b.Dialect.Exec(tx,`
 		UPDATE
 			ngrpcnt
 		SET
@@ -231,7 +258,8 @@ func (b *Base) GroupHeadInsert(groups [][]byte, buf []int64) (nums []int64, e er
 		WHERE
 			ngrp = $1
 		;`,group)
-		e = tx.QueryRow(`
+		if e!=nil { return }
+		e = b.Dialect.QueryRow(tx,`
 		SELECT
 			n.latest
 		FROM
@@ -254,7 +282,7 @@ func (b *PgBase) GroupHeadInsert(groups [][]byte, buf []int64) (nums []int64, e
 		nums = buf
 	}
 	for i,group := range groups {
-		e = b.DB.QueryRow(`
+		e = b.Dialect.QueryRow(b.DB,`
 		UPDATE	ngrpcnt
 		SET	latest = latest + 1
 		WHERE	ngrp = $1
@@ -266,27 +294,32 @@ func (b *PgBase) GroupHeadInsert(groups [][]byte, buf []int64) (nums []int64, e
 	return
 }
 
+// Decrements the latest number of each group, if it is still the number allocated by GroupHeadInsert.
 func (b *Base) GroupHeadRevert(groups [][]byte, nums []int64) error {
 	for i,group := range groups {
-		b.DB.Exec(`
+		b.Dialect.Exec(b.DB,`
 		UPDATE
 			ngrpcnt
 		SET
 			latest = latest - 1
 		WHERE
-			latest = $1,
+			latest = $1 AND
 			ngrp = $2
 		;`,nums[i],group)
 	}
 	return nil
 }
 
+/*
+The statistics view only contains groups with articles, so it is joined to ngrpcnt (LEFT JOIN,
+as SQLite before 3.39 has no RIGHT JOIN) to report empty groups as well.
+*/
 func (b *Base) GroupRealtimeQuery(group []byte) (number int64, low int64, high int64, ok bool) {
-	err := b.DB.QueryRow(`
+	err := b.Dialect.QueryRow(b.DB,`
 	SELECT
 		COALESCE(n.narts,0),COALESCE(n.low,0),COALESCE(n.high,0)
 	FROM
-		ngrpstat n RIGHT JOIN ngrpcnt m on n.ngrp=m.ngrp
+		ngrpcnt m LEFT JOIN ngrpstat n on n.ngrp=m.ngrp
 	WHERE
 		m.ngrp = $1
 	;`,group).Scan(&number,&low,&high)
@@ -299,11 +332,11 @@ func (b *Base) GroupRealtimeQuery(group []byte) (number int64, low int64, high i
 }
 
 func (b *Base) GroupRealtimeList(targ func(group []byte, high, low int64, status byte)) bool {
-	rows,err := b.DB.Query(`
+	rows,err := b.Dialect.Query(b.DB,`
 	SELECT
 		m.ngrp,COALESCE(n.high,0),COALESCE(n.low,0),m.status
 	FROM
-		ngrpstat n RIGHT JOIN ngrpcnt m on n.ngrp=m.ngrp
+		ngrpcnt m LEFT JOIN ngrpstat n on n.ngrp=m.ngrp
 	;`)
 	if err!=nil { return false }
 	var group sql.RawBytes
@@ -322,7 +355,7 @@ func (b *Base) GroupRealtimeList(targ func(group []byte, high, low int64, status
 }
 
 func (b *Base) GroupStaticList(targ func(group []byte, descr []byte)) bool {
-	rows,err := b.DB.Query(`
+	rows,err := b.Dialect.Query(b.DB,`
 	SELECT
 		ngrp,descr
 	FROM
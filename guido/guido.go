@@ -23,14 +23,29 @@ SOFTWARE.
 
 package guido
 
+import "errors"
 import "io/ioutil"
 import "path/filepath"
 import "os"
+import "time"
 import "github.com/nu7hatch/gouuid"
 import "github.com/lytics/confl"
 
+var ERetired = errors.New("Bucket is retired")
+
 type Config struct{
-	Uuid string
+	Uuid    string
+	Retired bool
+	
+	Kind     string // Backend kind, eg. "dayfile".
+	Created  string // Creation time (RFC3339).
+	Format   int    // On-disk format version of the backend.
+	Capacity int64  // MaxSpace, the bucket was created with.
+	Labels   map[string]string // Optional labels, eg. tier, rack or disk serial.
+}
+
+type ModeConfig struct{
+	Mode string
 }
 
 func GetUID(path string) (*uuid.UUID,error) {
@@ -39,6 +54,7 @@ func GetUID(path string) (*uuid.UUID,error) {
 	f := filepath.Join(path,"guid.cfg")
 	data,err := ioutil.ReadFile(f)
 	if err==nil { err = confl.Unmarshal(data, &cfg) }
+	if err==nil && cfg.Retired { return nil,ERetired }
 	if err==nil {
 		id,err = uuid.ParseHex(cfg.Uuid)
 		if err!=nil { err = &os.PathError{Op:"open",Err:err} }
@@ -57,3 +73,60 @@ func GetUID(path string) (*uuid.UUID,error) {
 	return id,nil
 }
 
+/*
+Returns the identity of the bucket, creating "guid.cfg" if it doesn't exist yet.
+Buckets created before the identity fields were introduced (Kind=="") are adopted:
+kind, format and capacity are filled in with the values passed in and written back.
+*/
+func GetIdentity(path, kind string, format int, capacity int64) (*Config,error) {
+	id,err := GetUID(path)
+	if err!=nil { return nil,err }
+	cfg := new(Config)
+	data,err := ioutil.ReadFile(filepath.Join(path,"guid.cfg"))
+	if err==nil { err = confl.Unmarshal(data, cfg) }
+	if err!=nil { return nil,err }
+	cfg.Uuid = id.String()
+	if cfg.Kind!="" { return cfg,nil }
+	cfg.Kind = kind
+	if cfg.Created=="" { cfg.Created = time.Now().UTC().Format(time.RFC3339) }
+	cfg.Format = format
+	cfg.Capacity = capacity
+	return cfg,PutIdentity(path,cfg)
+}
+
+// Overwrites "guid.cfg" with cfg.
+func PutIdentity(path string, cfg *Config) error {
+	data,err := confl.Marshal(cfg)
+	if err!=nil { return err }
+	return ioutil.WriteFile(filepath.Join(path,"guid.cfg"),data,0600)
+}
+
+// Marks the bucket as retired. GetUID will refuse to open it afterwards.
+func Retire(path string) error {
+	var cfg Config
+	f := filepath.Join(path,"guid.cfg")
+	data,err := ioutil.ReadFile(f)
+	if err!=nil { return err }
+	err = confl.Unmarshal(data, &cfg)
+	if err!=nil { return err }
+	cfg.Retired = true
+	data,err = confl.Marshal(&cfg)
+	if err!=nil { return err }
+	return ioutil.WriteFile(f,data,0600)
+}
+
+// Returns the bucket mode stored in "mode.cfg", or "" if there is none.
+func GetMode(path string) (string,error) {
+	var cfg ModeConfig
+	data,err := ioutil.ReadFile(filepath.Join(path,"mode.cfg"))
+	if os.IsNotExist(err) { return "",nil }
+	if err==nil { err = confl.Unmarshal(data, &cfg) }
+	return cfg.Mode,err
+}
+
+// Stores the bucket mode into "mode.cfg", next to "guid.cfg".
+func SetMode(path, mode string) error {
+	data,err := confl.Marshal(&ModeConfig{mode})
+	if err!=nil { return err }
+	return ioutil.WriteFile(filepath.Join(path,"mode.cfg"),data,0600)
+}
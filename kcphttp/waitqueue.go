@@ -29,10 +29,16 @@ import (
 	"math/rand"
 	"time"
 	"errors"
+	"github.com/maxymania/fastnntp-polyglot-labs/metrics"
 )
 
 var ETimeout = errors.New("deadline timeout")
 
+var (
+	mDepth    = metrics.Default.Gauge("kcphttp_waitqueue_depth","Requests waiting for a response.")
+	mTimeouts = metrics.Default.Counter("kcphttp_timeouts_total","Requests, that timed out.")
+)
+
 type WorkItem struct{
 	WG   sync.WaitGroup
 	Req  *fasthttp.Request
@@ -56,6 +62,7 @@ func (w *WIQueue) Push(wi *WorkItem) uint64 {
 		if ni == 0 { continue }
 		if _,ok := w.m[ni] ; ok { continue }
 		w.m[ni] = wi
+		mDepth.Add(1)
 		return ni
 	}
 	return 0
@@ -63,6 +70,7 @@ func (w *WIQueue) Push(wi *WorkItem) uint64 {
 func (w *WIQueue) Get(ni uint64) *WorkItem {
 	w.l.Lock(); defer w.l.Unlock()
 	wi := w.m[ni]
+	if wi!=nil { mDepth.Add(-1) }
 	delete(w.m,ni)
 	return wi
 }
@@ -74,6 +82,8 @@ func (w *WIQueue) EvictExpired() {
 			v.Err = ETimeout
 			v.WG.Done()
 			delete(w.m,k)
+			mDepth.Add(-1)
+			mTimeouts.Inc()
 		}
 	}
 }
@@ -84,6 +94,8 @@ func (w *WIQueue) EvictAll() {
 			v.Err = ETimeout
 			v.WG.Done()
 			delete(w.m,k)
+			mDepth.Add(-1)
+			mTimeouts.Inc()
 		}
 	}
 }
@@ -0,0 +1,175 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+/*
+A minimal metrics registry, serving the Prometheus text exposition format.
+
+Metrics are identified by their name and an optional list of label name/value pairs:
+
+	ops := metrics.Default.Counter("bucket_ops_total","Operations per bucket.","bucket",uuid,"op","get")
+	ops.Inc()
+*/
+package metrics
+
+import "bufio"
+import "fmt"
+import "io"
+import "math"
+import "sort"
+import "strings"
+import "sync"
+import "sync/atomic"
+import "github.com/valyala/fasthttp"
+
+type Counter struct{
+	v uint64
+}
+func (c *Counter) Inc() { atomic.AddUint64(&c.v,1) }
+func (c *Counter) Add(n uint64) { atomic.AddUint64(&c.v,n) }
+func (c *Counter) Value() uint64 { return atomic.LoadUint64(&c.v) }
+
+type Gauge struct{
+	v int64
+}
+func (g *Gauge) Set(n int64) { atomic.StoreInt64(&g.v,n) }
+func (g *Gauge) Add(n int64) { atomic.AddInt64(&g.v,n) }
+func (g *Gauge) Value() int64 { return atomic.LoadInt64(&g.v) }
+
+type series struct{
+	labels string
+	metric interface{}
+}
+func (s *series) value() float64 {
+	switch v := s.metric.(type) {
+	case *Counter: return float64(v.Value())
+	case *Gauge: return float64(v.Value())
+	case func() float64: return v()
+	}
+	return math.NaN()
+}
+
+type family struct{
+	name, help, typ string
+	series map[string]*series
+}
+
+type Registry struct{
+	mutex sync.Mutex
+	fams  map[string]*family
+}
+func NewRegistry() *Registry {
+	return &Registry{fams:make(map[string]*family)}
+}
+
+// The registry, the packages of this repository report into.
+var Default = NewRegistry()
+
+var escaper = strings.NewReplacer(`\`,`\\`,`"`,`\"`,"\n",`\n`)
+
+func formatLabels(labels []string) string {
+	if len(labels)<2 { return "" }
+	s := make([]string,0,len(labels)/2)
+	for i := 0 ; i+1<len(labels) ; i+=2 {
+		s = append(s,labels[i]+`="`+escaper.Replace(labels[i+1])+`"`)
+	}
+	return "{"+strings.Join(s,",")+"}"
+}
+
+func (r *Registry) get(name, help, typ string, labels []string, create func() interface{}) interface{} {
+	lbl := formatLabels(labels)
+	r.mutex.Lock(); defer r.mutex.Unlock()
+	f := r.fams[name]
+	if f==nil {
+		f = &family{name:name,help:help,typ:typ,series:make(map[string]*series)}
+		r.fams[name] = f
+	}
+	s := f.series[lbl]
+	if s==nil {
+		s = &series{lbl,create()}
+		f.series[lbl] = s
+	}
+	return s.metric
+}
+
+// Returns the counter with the given name and labels, creating it, if necessary.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	c,_ := r.get(name,help,"counter",labels,func() interface{} { return new(Counter) }).(*Counter)
+	if c==nil { c = new(Counter) } // Name registered with an other type.
+	return c
+}
+
+// Returns the gauge with the given name and labels, creating it, if necessary.
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	g,_ := r.get(name,help,"gauge",labels,func() interface{} { return new(Gauge) }).(*Gauge)
+	if g==nil { g = new(Gauge) }
+	return g
+}
+
+// Registers (or replaces) a gauge, whose value is obtained by calling f.
+func (r *Registry) GaugeFunc(name, help string, f func() float64, labels ...string) {
+	r.Unregister(name,labels...)
+	r.get(name,help,"gauge",labels,func() interface{} { return f })
+}
+
+// Removes a metric.
+func (r *Registry) Unregister(name string, labels ...string) {
+	r.mutex.Lock(); defer r.mutex.Unlock()
+	f := r.fams[name]
+	if f==nil { return }
+	delete(f.series,formatLabels(labels))
+	if len(f.series)==0 { delete(r.fams,name) }
+}
+
+// Writes all metrics in the Prometheus text exposition format.
+func (r *Registry) WriteText(w io.Writer) error {
+	type fsnap struct{
+		*family
+		series []*series
+	}
+	r.mutex.Lock()
+	snap := make([]fsnap,0,len(r.fams))
+	for _,f := range r.fams {
+		fs := fsnap{f,make([]*series,0,len(f.series))}
+		for _,s := range f.series { fs.series = append(fs.series,s) }
+		snap = append(snap,fs)
+	}
+	r.mutex.Unlock()
+	sort.Slice(snap,func(i,j int) bool { return snap[i].name<snap[j].name })
+	
+	/* Values are obtained without holding the lock: GaugeFuncs may take locks on their own. */
+	bw := bufio.NewWriter(w)
+	for _,fs := range snap {
+		sort.Slice(fs.series,func(i,j int) bool { return fs.series[i].labels<fs.series[j].labels })
+		fmt.Fprintf(bw,"# HELP %s %s\n",fs.name,strings.Replace(fs.help,"\n"," ",-1))
+		fmt.Fprintf(bw,"# TYPE %s %s\n",fs.name,fs.typ)
+		for _,s := range fs.series {
+			fmt.Fprintf(bw,"%s%s %v\n",fs.name,s.labels,s.value())
+		}
+	}
+	return bw.Flush()
+}
+
+// Serves the metrics over fasthttp.
+func (r *Registry) Handler(ctx *fasthttp.RequestCtx) {
+	ctx.SetContentType("text/plain; version=0.0.4")
+	r.WriteText(ctx)
+}
@@ -26,6 +26,9 @@ package oohttp
 import "github.com/valyala/fastrpc"
 import "github.com/valyala/fasthttp"
 import "time"
+import "github.com/maxymania/fastnntp-polyglot-labs/metrics"
+
+var mErrors = metrics.Default.Counter("oohttp_errors_total","Failed requests (including timeouts).")
 
 func InitServer(s *fastrpc.Server, hnd fasthttp.RequestHandler) {
 	s.SniffHeader = SniffHeader
@@ -47,7 +50,9 @@ func (c *Client) Init() {
 func (c *Client) DoDeadline(req *fasthttp.Request, resp *fasthttp.Response, deadline time.Time) error {
 	wreq := WrappedRequest{req}
 	wresp := WrappedResponse{resp}
-	return c.Inner.DoDeadline(&wreq,&wresp,deadline)
+	err := c.Inner.DoDeadline(&wreq,&wresp,deadline)
+	if err!=nil { mErrors.Inc() }
+	return err
 }
 func (c *Client) PendingRequests() int {
 	return c.Inner.PendingRequests()
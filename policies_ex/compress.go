@@ -63,6 +63,24 @@ func ZopfliDeflate(d policies.DEFLATE,data []byte) []byte {
 	return buf.Bytes()
 }
 
+/*
+ The first byte of uncompressed data stored by RawDeflate. It denotes a final DEFLATE block of the
+ reserved type 3, which never appears in a valid DEFLATE stream.
+ */
+const RawMarker = 0x07
+
+/*
+ Stores the data uncompressed, prefixed with RawMarker.
+ Unlike policies.NoDeflate, the data can be accessed at arbitrary offsets, which makes byte ranges
+ meaningful, eg. for binary groups.
+ */
+func RawDeflate(d policies.DEFLATE,data []byte) []byte {
+	buf := make([]byte,len(data)+1)
+	buf[0] = RawMarker
+	copy(buf[1:],data)
+	return buf
+}
+
 /* Faster alternaticve to policies.NewDeflateFunction(level int) */
 func NewDeflateFunction(level int) policies.DeflateFunction {
 	if level<  -2 || 9<level { panic(fmt.Errorf("Invalid level: %d",level)) }
@@ -31,6 +31,8 @@ type LayerElement struct {
 	
 	ExpireDays int
 	
+	StorageClass string // Storage class of the buckets to place the article in. "" = don't care.
+	
 	Criteria *Matcher
 }
 
@@ -40,8 +42,25 @@ type Layer struct {
 	PerformAll bool
 }
 
+/*
+A PostingPolicy, that also determines the storage class of an article.
+policies.PostingDecision has no room for it, so it is returned alongside.
+*/
+type ClassPolicy interface{
+	policies.PostingPolicy
+	DecideClass(groups [][]byte, lines, length int64) (policies.PostingDecision,string)
+}
+
 func (l *Layer) Decide(groups [][]byte, lines, length int64) policies.PostingDecision {
-	pd := l.Inner.Decide(groups,lines,length)
+	pd,_ := l.DecideClass(groups,lines,length)
+	return pd
+}
+func (l *Layer) DecideClass(groups [][]byte, lines, length int64) (pd policies.PostingDecision,class string) {
+	if cp,ok := l.Inner.(ClassPolicy) ; ok {
+		pd,class = cp.DecideClass(groups,lines,length)
+	} else {
+		pd = l.Inner.Decide(groups,lines,length)
+	}
 	for _,e := range l.Element {
 		if !e.Criteria.Match(groups,lines,length) { continue }
 		
@@ -49,9 +68,10 @@ func (l *Layer) Decide(groups [][]byte, lines, length int64) policies.PostingDec
 		if e.Head!=nil { pd.CompressHeader = e.Head }
 		if e.Body!=nil { pd.CompressBody = e.Body }
 		if e.ExpireDays>0 { pd.ExpireAt = time.Now().UTC().AddDate(0,0,e.ExpireDays) }
+		if e.StorageClass!="" { class = e.StorageClass }
 		
 		if !l.PerformAll { break }
 	}
-	return pd
+	return
 }
 
@@ -36,6 +36,7 @@ type LayerElemCfg struct{
 	Adaptive map[string]*policies_ex.AdaptiveDeflatorConfig `inn:"%adaptive!"`
 	Compress map[string]*CompressionCfg                     `inn:"%compress!"`
 	ExpiresAfter int                                        `inn:"expire-after"`
+	StorageClass string                                     `inn:"storage-class"`
 }
 func (l *LayerElemCfg) getCompressor(n string) policies.DeflateFunction {
 	if l.Adaptive!=nil {
@@ -52,6 +53,7 @@ func (l *LayerElemCfg) getCompressor(n string) policies.DeflateFunction {
 			case "zopfli":  return policies_ex.ZopfliDeflate
 			case "fast": return policies_ex.FastDeflate
 			case "huffman": return policies_ex.HuffmanOnlyDeflate
+			case "raw": return policies_ex.RawDeflate
 			}
 			return policies_ex.NewDeflateFunction(cf.Level)
 		}
@@ -71,6 +73,7 @@ func (l *LayerElemCfg) CreateLayerElement() (elem policies_ex.LayerElement) {
 	elem.Body  = l.getCompressor("body")
 	
 	elem.ExpireDays = l.ExpiresAfter
+	elem.StorageClass = l.StorageClass
 	
 	return
 }
@@ -0,0 +1,177 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package sqlutil
+
+import "bytes"
+import "database/sql"
+import "fmt"
+import "io"
+import "text/template"
+
+/*
+A single schema change. SQL is executed with the Dialect as data, the result is run as a script
+(see ExecScript). Func, if set, runs afterwards, within the same transaction.
+*/
+type Migration struct{
+	Version int
+	Name    string
+	SQL     *template.Template
+	Func    func(tx *sql.Tx, d *Dialect) error
+}
+
+// The ordered migrations of a model. The versions start at 1 and increase.
+type Schema struct{
+	Model      string
+	Migrations []Migration
+	Dialects   []*Dialect // Optional. The supported dialects. nil = all.
+	
+	/*
+	Optional. A table created by the first migration. If it exists, but no version has been
+	recorded, the database predates schema versioning and version 1 is adopted (see Adopt).
+	*/
+	Probe string
+}
+
+// Implemented by SQL models, that support migrations.
+type Migratable interface{
+	SqlSchema() *Schema
+}
+
+var EUnsupportedDialect = fmt.Errorf("Dialect not supported by this model")
+
+const versionTable = `
+	CREATE TABLE IF NOT EXISTS schemaversion (
+		model   varchar(64) PRIMARY KEY,
+		version integer
+	);`
+
+func (s *Schema) supports(d *Dialect) bool {
+	if s.Dialects==nil { return true }
+	d = d.Def()
+	for _,sd := range s.Dialects {
+		if sd.Def()==d { return true }
+	}
+	return false
+}
+
+// Returns the installed version of the model. 0, if the model has not been installed (or adopted).
+func (s *Schema) Version(e Execer, d *Dialect) (v int, err error) {
+	err = d.QueryRow(e,`SELECT version FROM schemaversion WHERE model=$1;`,s.Model).Scan(&v)
+	if err==sql.ErrNoRows { err = nil }
+	return
+}
+
+func (s *Schema) setVersion(e Execer, d *Dialect, v int) error {
+	res,err := d.Exec(e,`UPDATE schemaversion SET version=$1 WHERE model=$2;`,v,s.Model)
+	if err!=nil { return err }
+	if n,err := res.RowsAffected() ; err==nil && n>0 { return nil }
+	_,err = d.Exec(e,`INSERT INTO schemaversion (model,version) VALUES ($1,$2);`,s.Model,v)
+	return err
+}
+
+// Reports, whether the Probe table exists.
+func (s *Schema) probe(e Execer) bool {
+	if s.Probe=="" { return false }
+	rows,err := e.Query(`SELECT 1 FROM `+s.Probe+` WHERE 1=0;`)
+	if err!=nil { return false }
+	rows.Close()
+	return true
+}
+
+/*
+Records version as installed, without running any migration. This is meant for databases,
+that were created before schema versioning (eg. by an older CreateSqlModel).
+*/
+func (s *Schema) Adopt(e Execer, d *Dialect, version int) error {
+	if _,err := e.Exec(versionTable) ; err!=nil { return err }
+	return s.setVersion(e,d,version)
+}
+
+// Renders the SQL script of a migration.
+func (m *Migration) Script(d *Dialect) (string,error) {
+	if m.SQL==nil { return "",nil }
+	buf := new(bytes.Buffer)
+	err := m.SQL.Execute(buf,d.Def())
+	return buf.String(),err
+}
+
+/*
+Applies all pending migrations, each one within its own transaction, and returns their versions.
+If no version has been recorded, but the Probe table exists, version 1 is adopted first.
+
+If dryRun is not nil, nothing is changed. Instead, the pending migrations are written to dryRun.
+*/
+func (s *Schema) Migrate(db *sql.DB, d *Dialect, dryRun io.Writer) (applied []int, err error) {
+	if !s.supports(d) { return nil,EUnsupportedDialect }
+	if dryRun==nil {
+		if _,err = db.Exec(versionTable) ; err!=nil { return }
+	}
+	cur,err := s.Version(db,d)
+	if err!=nil {
+		if dryRun==nil { return }
+		cur,err = 0,nil // The version table doesn't exist yet.
+	}
+	if cur==0 && s.probe(db) {
+		if dryRun!=nil {
+			fmt.Fprintf(dryRun,"-- %s: table %s exists, adopting version 1\n",s.Model,s.Probe)
+		} else if err = s.setVersion(db,d,1) ; err!=nil {
+			return
+		}
+		cur = 1
+	}
+	for i := range s.Migrations {
+		m := &s.Migrations[i]
+		if m.Version<=cur { continue }
+		script,e := m.Script(d)
+		if e!=nil { return applied,e }
+		if dryRun!=nil {
+			fmt.Fprintf(dryRun,"-- %s %d: %s\n%s\n",s.Model,m.Version,m.Name,script)
+			if m.Func!=nil { fmt.Fprintf(dryRun,"-- (+ data migration)\n") }
+			applied = append(applied,m.Version)
+			continue
+		}
+		if err = s.apply(db,d,m,script) ; err!=nil {
+			return applied,fmt.Errorf("%s %d (%s): %v",s.Model,m.Version,m.Name,err)
+		}
+		applied = append(applied,m.Version)
+	}
+	return
+}
+
+func (s *Schema) apply(db *sql.DB, d *Dialect, m *Migration, script string) (err error) {
+	tx,err := db.Begin()
+	if err!=nil { return }
+	defer func() {
+		if err!=nil { tx.Rollback() ; return }
+		err = tx.Commit()
+	}()
+	if script!="" {
+		if err = d.ExecScript(tx,script) ; err!=nil { return }
+	}
+	if m.Func!=nil {
+		if err = m.Func(tx,d) ; err!=nil { return }
+	}
+	return s.setVersion(tx,d,m.Version)
+}
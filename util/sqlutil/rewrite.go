@@ -0,0 +1,137 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+package sqlutil
+
+import "bytes"
+import "database/sql"
+import "strconv"
+import "strings"
+
+// The subset of *sql.DB and *sql.Tx used by the helpers below.
+type Execer interface{
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Implemented by *sql.DB and *sql.Tx.
+type Preparer interface{
+	Prepare(query string) (*sql.Stmt, error)
+}
+
+/*
+Rewrites the placeholders of query ($1, $2, ...) into the syntax of the dialect. As ? placeholders are
+positional, the arguments are reordered (and duplicated) accordingly. Placeholders within string
+literals are left alone.
+*/
+func (d *Dialect) Rewrite(query string, args []interface{}) (string, []interface{}) {
+	d = d.Def()
+	if d.Placeholder==Dollar { return query,args }
+	var b bytes.Buffer
+	var nargs []interface{}
+	quoted := false
+	for i := 0 ; i<len(query) ; i++ {
+		c := query[i]
+		if c=='\'' { quoted = !quoted }
+		if c!='$' || quoted { b.WriteByte(c) ; continue }
+		j := i+1
+		for j<len(query) && '0'<=query[j] && query[j]<='9' { j++ }
+		n,err := strconv.Atoi(query[i+1:j])
+		if err!=nil || n<1 || n>len(args) { b.WriteByte(c) ; continue }
+		nargs = append(nargs,args[n-1])
+		switch d.Placeholder {
+		case Question: b.WriteByte('?')
+		case AtP: b.WriteString("@p"+strconv.Itoa(len(nargs)))
+		}
+		i = j-1
+	}
+	return b.String(),nargs
+}
+
+/*
+Like Rewrite, but without arguments. Suitable for prepared statements, if every placeholder
+occurs once, in ascending order.
+*/
+func (d *Dialect) Rebind(query string) string {
+	args := make([]interface{},strings.Count(query,"$"))
+	q,_ := d.Rewrite(query,args)
+	return q
+}
+
+func (d *Dialect) Exec(e Execer, query string, args ...interface{}) (sql.Result, error) {
+	query,args = d.Rewrite(query,args)
+	return e.Exec(query,args...)
+}
+func (d *Dialect) Query(e Execer, query string, args ...interface{}) (*sql.Rows, error) {
+	query,args = d.Rewrite(query,args)
+	return e.Query(query,args...)
+}
+func (d *Dialect) QueryRow(e Execer, query string, args ...interface{}) *sql.Row {
+	query,args = d.Rewrite(query,args)
+	return e.QueryRow(query,args...)
+}
+func (d *Dialect) Prepare(p Preparer, query string) (*sql.Stmt, error) {
+	return p.Prepare(d.Rebind(query))
+}
+
+// Executes update, or insert, if update affected no row.
+func (d *Dialect) Upsert(e Execer, update, insert string, uargs, iargs []interface{}) error {
+	res,err := d.Exec(e,update,uargs...)
+	if err!=nil { return err }
+	if n,err := res.RowsAffected() ; err==nil && n>0 { return nil }
+	_,err = d.Exec(e,insert,iargs...)
+	return err
+}
+
+/*
+Executes a script of multiple statements, separated by semicolons. If the dialect doesn't support
+multiple statements per Exec, the statements are executed one by one.
+*/
+func (d *Dialect) ExecScript(e Execer, script string) error {
+	if d.Def().MultiStatement {
+		_,err := e.Exec(script)
+		return err
+	}
+	for _,stmt := range splitScript(script) {
+		if _,err := e.Exec(stmt) ; err!=nil { return err }
+	}
+	return nil
+}
+
+func splitScript(script string) (stmts []string) {
+	quoted := false
+	start := 0
+	for i := 0 ; i<len(script) ; i++ {
+		switch script[i] {
+		case '\'': quoted = !quoted
+		case ';':
+			if quoted { continue }
+			if s := strings.TrimSpace(script[start:i]) ; s!="" { stmts = append(stmts,s) }
+			start = i+1
+		}
+	}
+	if s := strings.TrimSpace(script[start:]) ; s!="" { stmts = append(stmts,s) }
+	return
+}
@@ -0,0 +1,83 @@
+/*
+Copyright (c) 2018 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+
+
+package sqlutil
+
+import "reflect"
+import "testing"
+
+func TestRewrite(t *testing.T) {
+	tests := []struct{
+		d     *Dialect
+		query string
+		args  []interface{}
+		wq    string
+		wargs []interface{}
+	}{
+		{nil, `x=$1 AND y=$2`, []interface{}{1,2}, `x=$1 AND y=$2`, []interface{}{1,2}},
+		{PgDialect, `x=$2 AND y=$1`, []interface{}{1,2}, `x=$2 AND y=$1`, []interface{}{1,2}},
+		/* Reordering. */
+		{SqliteDialect, `x=$2 AND y=$1`, []interface{}{1,2}, `x=? AND y=?`, []interface{}{2,1}},
+		{MsSqlDialect, `x=$2 AND y=$1`, []interface{}{1,2}, `x=@p1 AND y=@p2`, []interface{}{2,1}},
+		/* Duplicated placeholders. */
+		{MySqlDialect, `x=$1 OR y=$1`, []interface{}{"a"}, `x=? OR y=?`, []interface{}{"a","a"}},
+		{MsSqlDialect, `x=$1 OR y=$1`, []interface{}{"a"}, `x=@p1 OR y=@p2`, []interface{}{"a","a"}},
+		/* Multi-digit placeholders. */
+		{SqliteDialect, `x=$10,y=$1`, []interface{}{1,2,3,4,5,6,7,8,9,10}, `x=?,y=?`, []interface{}{10,1}},
+		/* Quoted literals are left alone. */
+		{SqliteDialect, `x='$1' AND y=$1`, []interface{}{1}, `x='$1' AND y=?`, []interface{}{1}},
+		{SqliteDialect, `x='it''s $1' AND y=$1`, []interface{}{1}, `x='it''s $1' AND y=?`, []interface{}{1}},
+		/* Out of range or not a placeholder. */
+		{SqliteDialect, `x=$2 AND y=$ AND z=$1`, []interface{}{1}, `x=$2 AND y=$ AND z=?`, []interface{}{1}},
+	}
+	for _,tt := range tests {
+		q,args := tt.d.Rewrite(tt.query,tt.args)
+		if q!=tt.wq { t.Errorf("Rewrite(%q): query = %q, want %q",tt.query,q,tt.wq) }
+		if !reflect.DeepEqual(args,tt.wargs) { t.Errorf("Rewrite(%q): args = %v, want %v",tt.query,args,tt.wargs) }
+	}
+}
+
+func TestRebind(t *testing.T) {
+	q := MsSqlDialect.Rebind(`INSERT INTO t (a,b,c) VALUES ($1,$2,$3);`)
+	if w := `INSERT INTO t (a,b,c) VALUES (@p1,@p2,@p3);` ; q!=w { t.Errorf("Rebind: %q, want %q",q,w) }
+}
+
+func TestSplitScript(t *testing.T) {
+	tests := []struct{
+		script string
+		want   []string
+	}{
+		{``, nil},
+		{` ; ;`, nil},
+		{`CREATE TABLE a (x integer);`, []string{`CREATE TABLE a (x integer)`}},
+		{"CREATE TABLE a (x integer);\n\tCREATE INDEX b ON a (x)", []string{`CREATE TABLE a (x integer)`,`CREATE INDEX b ON a (x)`}},
+		{`INSERT INTO a VALUES ('x;y'); DELETE FROM a;;`, []string{`INSERT INTO a VALUES ('x;y')`,`DELETE FROM a`}},
+		{`INSERT INTO a VALUES ('it''s;'); SELECT 1`, []string{`INSERT INTO a VALUES ('it''s;')`,`SELECT 1`}},
+	}
+	for _,tt := range tests {
+		got := splitScript(tt.script)
+		if !reflect.DeepEqual(got,tt.want) { t.Errorf("splitScript(%q) = %q, want %q",tt.script,got,tt.want) }
+	}
+}
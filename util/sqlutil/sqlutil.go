@@ -23,8 +23,28 @@ SOFTWARE.
 
 package sqlutil
 
+// The placeholder syntax of a database driver.
+type Placeholder uint8
+const (
+	Dollar   Placeholder = iota // $1, $2, ... (PostgreSQL)
+	Question                    // ?, ? ... (SQLite, MySQL)
+	AtP                         // @p1, @p2, ... (Microsoft SQL Server)
+)
+
+/*
+Describes the types and the features of an SQL database. All queries are written with PostgreSQL-style
+placeholders ($1, $2, ...), that are rewritten according to the Placeholder syntax (see Rewrite).
+
+A nil *Dialect is equivalent to PgDialect.
+*/
 type Dialect struct{
 	Binary, Int64, Date, Byte string
+	
+	Placeholder Placeholder
+	
+	Returning      bool // UPDATE ... RETURNING is supported.
+	MultiStatement bool // Exec accepts multiple statements at once.
+	Limit          bool // SELECT ... LIMIT n is supported. Otherwise SELECT TOP n is used.
 }
 
 // PostgreSQL
@@ -33,6 +53,10 @@ var PgDialect = &Dialect{
 	Int64: "bigint",
 	Date: "date",
 	Byte: "smallint",
+	Placeholder: Dollar,
+	Returning: true,
+	MultiStatement: true,
+	Limit: true,
 }
 
 // Microsoft SQL Server
@@ -42,10 +66,41 @@ var MsSqlDialect = &Dialect{
 	Int64: "bigint",
 	Date: "date",
 	Byte: "tinyint",
+	Placeholder: AtP,
+	MultiStatement: true,
 }
 
-type SqlModel interface{
-	CreateSqlModel(d *Dialect) error
+// SQLite (github.com/mattn/go-sqlite3)
+var SqliteDialect = &Dialect{
+	Binary: "blob",
+	Int64: "integer",
+	Date: "date",
+	Byte: "integer",
+	Placeholder: Question,
+	MultiStatement: true,
+	Limit: true,
+}
+
+/*
+MySQL and MariaDB (github.com/go-sql-driver/mysql).
+The DSN must contain "parseTime=true", as dates are scanned into time.Time.
+Binary columns are limited to 255 bytes, as they are used as (parts of) primary keys.
+*/
+var MySqlDialect = &Dialect{
+	Binary: "varbinary(255)",
+	Int64: "bigint",
+	Date: "date",
+	Byte: "tinyint",
+	Placeholder: Question,
+	Limit: true,
 }
 
+// Returns d, or PgDialect, if d is nil.
+func (d *Dialect) Def() *Dialect {
+	if d==nil { return PgDialect }
+	return d
+}
 
+type SqlModel interface{
+	CreateSqlModel(d *Dialect) error
+}